@@ -2,4 +2,17 @@ module github.com/Sunny1987/ServerBase
 
 go 1.22
 
-require github.com/common-nighthawk/go-figure v0.0.0-20210622060536-734e95fb86be
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/common-nighthawk/go-figure v0.0.0-20210622060536-734e95fb86be
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
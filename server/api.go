@@ -8,12 +8,20 @@ package server
 
 import (
 	"context"
-	"github.com/common-nighthawk/go-figure"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/http2"
 )
 
 var (
@@ -27,21 +35,53 @@ type MyServer struct {
 	// ServeMux is the default ServeMux for handling HTTP requests.
 	ServeMux *http.ServeMux
 
-	// MiddlewareList contains middleware functions to be applied to standard handler functions.
+	// MiddlewareList contains the standard middleware functions added with AddMiddleware.
+	// Middleware appended to the list directly runs after the middleware added with AddMiddleware and AddMiddlewareN.
 	MiddlewareList []Middleware
 
-	// MiddlewareListN contains middleware functions to be applied to ContextHandler functions.
+	// MiddlewareListN contains the converted ContextHandler middleware functions added with AddMiddlewareN.
+	// Middleware appended to the list directly runs last, after the one appended to MiddlewareList.
 	MiddlewareListN []MiddlewareConvertedN
 
+	// middlewareOrder records the style of each middleware added, true for ContextHandler middleware,
+	// so that MiddlewareList and MiddlewareListN are applied in the order they were added.
+	middlewareOrder []bool
+
 	// PrefixServeMux is an optional ServeMux for handling requests with a specific prefix.
 	PrefixServeMux *http.ServeMux
+
+	// Routes contains the routes registered through the server, in registration order.
+	Routes []Route
+
+	// NotFoundHandler is the optional handler called for requests matching no route.
+	NotFoundHandler http.Handler
+
+	// MethodNotAllowedHandler is the optional handler called for requests matching routes of other methods only.
+	MethodNotAllowedHandler http.Handler
+
+	// autoOptions records the patterns for which an OPTIONS handler was registered automatically.
+	autoOptions map[string]bool
 }
 
 // MyAPIServer represents the configuration for the API server.
 type MyAPIServer struct {
-	// Addr is the address the server will listen on.
+	// Addr is the address the server will listen on, ":8080" by default, or a Unix domain socket as "unix:/path/to.sock".
+	// It is left empty when only Listeners are provided.
 	Addr string
 
+	// Addrs are additional addresses to serve on with the same routes, e.g. a loopback address for internal tools.
+	Addrs []string
+
+	// Listeners are listeners created by the caller to serve on, in addition to Addr and Addrs.
+	Listeners []net.Listener
+
+	// UnixSocketMode is the file mode of the Unix domain sockets created for "unix:" addresses, e.g. 0660.
+	UnixSocketMode os.FileMode
+
+	// SystemdActivation serves on the sockets passed by systemd socket activation (LISTEN_FDS) instead of
+	// Addr and Addrs when the process was started with some.
+	SystemdActivation bool
+
 	// Dns is the domain name of the server.
 	Dns string
 
@@ -63,21 +103,164 @@ type MyAPIServer struct {
 	// IdleTimeout is the maximum duration the server is allowed to idle without activity.
 	IdleTimeout time.Duration
 
+	// ReadHeaderTimeout is the maximum duration for reading the request headers (10s when 0), which protects
+	// the server from clients sending them slowly.
+	ReadHeaderTimeout time.Duration
+
+	// MaxHeaderBytes is the maximum size of the request headers, including the request line (1MB when 0).
+	MaxHeaderBytes int
+
+	// H2C serves HTTP/2 over cleartext connections, to clients upgrading with "Upgrade: h2c" and to clients
+	// with prior knowledge, e.g. for traffic between internal services. It has no effect with TLS.
+	H2C bool
+
+	// HTTP2 tunes HTTP/2: concurrent streams, frame and header table sizes, flow control windows and health checks.
+	HTTP2 HTTP2Options
+
+	// ConnState is called when a client connection changes state, see OnConnState.
+	ConnState ConnStateHook
+
 	// Serv is the instance of the MyServer.
 	Serv *MyServer
 
 	// Logger is the logger instance for logging server events.
 	Logger *log.Logger
 
-	// HandlerNew determines whether the server uses the new handler functions or the old ones.
+	// CollectConfigErrors determines whether configuration problems are collected and returned by
+	// Validate and Run, instead of ending the process as soon as they are found.
+	CollectConfigErrors bool
+
+	// MaxBodyBytes is the maximum size of a request body read by the ContextHandler decoding helpers.
+	// A negative value disables the limit. Routes can override it with the BodyLimit middleware.
+	MaxBodyBytes int64
+
+	// StrictJSON determines whether DecodeJSON rejects fields unknown to the target struct.
+	StrictJSON bool
+
+	// ErrorRenderer writes the response for errors passed to ContextHandler.Error, returned by handlers
+	// wrapped with HandlerWrapperE, and for unmatched requests. DefaultErrorRenderer is used when nil.
+	ErrorRenderer ErrorRenderer
+
+	// JSONOptions configures the JSON responses: indentation, HTML escaping, marshaller and JSONP.
+	JSONOptions JSONOptions
+
+	// WebSocketOptions configures the WebSocket endpoints: origin checks, subprotocols, compression and limits.
+	WebSocketOptions WSOptions
+
+	// TLS configures HTTPS: certificates, minimum version, cipher suites, client certificates and the redirect listener.
+	TLS TLSOptions
+
+	// ShutdownSignals are the signals triggering a graceful shutdown (os.Interrupt and SIGTERM when empty).
+	ShutdownSignals []os.Signal
+
+	// DrainTimeout is how long in-flight requests may run once shutdown started before they are forcibly closed (30s when 0).
+	DrainTimeout time.Duration
+
+	// ReadinessDelay is how long the server keeps serving after reporting not ready, so that load balancers
+	// stop sending traffic before the listener closes.
+	ReadinessDelay time.Duration
+
+	// GracefulRestart makes Run restart the server without refusing connections when one of the RestartSignals
+	// is received: the executable is started again with the listening sockets, and this process is drained.
+	GracefulRestart bool
+
+	// RestartSignals are the signals triggering a graceful restart (SIGHUP and SIGUSR2 when empty).
+	RestartSignals []os.Signal
+
+	// RestartTimeout is how long a graceful restart waits for the new process to be ready (30s when 0).
+	RestartTimeout time.Duration
+
+	// Config is the loader the options were loaded with, set by ConfigLoader.Load. The effective
+	// configuration is logged when the server starts, with secrets redacted.
+	Config *ConfigLoader
+
+	// configErrors contains the configuration problems collected so far.
+	configErrors ConfigErrors
+
+	// validators contains the custom validation rules registered with RegisterValidator.
+	validators map[string]ValidatorFunc
+
+	// codecRegistry contains the encoders and decoders used for content negotiation.
+	codecRegistry *codecRegistry
+	codecOnce     sync.Once
+
+	// sseBroker is the Server-Sent Events broker returned by SSEBroker, closed on shutdown.
+	sseBroker *SSEBroker
+	sseOnce   sync.Once
+
+	// wsHub tracks the open WebSocket connections, closed on shutdown.
+	wsHub  *WSHub
+	wsOnce sync.Once
+
+	// tlsConfig is the TLS configuration built from the TLS options, nil for plain HTTP.
+	tlsConfig *tls.Config
+
+	// certReloader reloads the certificate files when they change.
+	certReloader *certReloader
+
+	// redirectServer redirects plain HTTP requests to HTTPS when TLS.RedirectAddr is set.
+	redirectServer *http.Server
+
+	// connStateHooks are the hooks added with OnConnState.
+	connStateHooks []ConnStateHook
+
+	// redirectListener is the listener of the redirect server, handed over on graceful restarts.
+	redirectListener net.Listener
+
+	// restartReady is the pipe on which a process started by a graceful restart reports being ready.
+	restartReady *os.File
+
+	// pendingConns tracks the connections accepted but whose first request is not read yet.
+	pendingConns pendingConns
+
+	// beforeShutdown and afterShutdown are the hooks run around the draining of the requests.
+	beforeShutdown []ShutdownHook
+	afterShutdown  []ShutdownHook
+
+	// inFlight tracks the requests being handled, reported when the drain timeout is reached.
+	inFlight inFlightRequests
+
+	// ready is the readiness reported by Ready and ReadinessHandler.
+	ready atomic.Bool
+
+	// lifecycleMu guards the running server state below.
+	lifecycleMu sync.Mutex
+	httpServer  *http.Server
+	listeners   []net.Listener
+	handOffs    []*handOffListener
+	stopping    bool
+	restarting  bool
+	serveErr    error
+
+	// done is closed once the server stops serving.
+	done chan struct{}
+
+	// HandlerNew records whether the server was created with the NewHandler option.
+	//
+	// Deprecated: standard and ContextHandler routes and middleware can be mixed on the same
+	// server, so the flag no longer changes the behaviour of the server.
 	HandlerNew bool
 }
 
 // OptionalParams represents optional parameters for configuring the API server.
 type OptionalParams struct {
-	// Addr is the address the server will listen on.
+	// Addr is the address the server will listen on, ":8080" by default, or a Unix domain socket as "unix:/path/to.sock".
+	// It is left empty when only Listeners are provided.
 	Addr string
 
+	// Addrs are additional addresses to serve on with the same routes, e.g. a loopback address for internal tools.
+	Addrs []string
+
+	// Listeners are listeners created by the caller to serve on, in addition to Addr and Addrs.
+	Listeners []net.Listener
+
+	// UnixSocketMode is the file mode of the Unix domain sockets created for "unix:" addresses, e.g. 0660.
+	UnixSocketMode os.FileMode
+
+	// SystemdActivation serves on the sockets passed by systemd socket activation (LISTEN_FDS) instead of
+	// Addr and Addrs when the process was started with some.
+	SystemdActivation bool
+
 	// Dns is the domain name of the server.
 	Dns string
 
@@ -99,11 +282,80 @@ type OptionalParams struct {
 	// IdleTimeout is the maximum duration the server is allowed to idle without activity.
 	IdleTimeout time.Duration
 
+	// ReadHeaderTimeout is the maximum duration for reading the request headers (10s when 0), which protects
+	// the server from clients sending them slowly.
+	ReadHeaderTimeout time.Duration
+
+	// MaxHeaderBytes is the maximum size of the request headers, including the request line (1MB when 0).
+	MaxHeaderBytes int
+
+	// H2C serves HTTP/2 over cleartext connections, to clients upgrading with "Upgrade: h2c" and to clients
+	// with prior knowledge, e.g. for traffic between internal services. It has no effect with TLS.
+	H2C bool
+
+	// HTTP2 tunes HTTP/2: concurrent streams, frame and header table sizes, flow control windows and health checks.
+	HTTP2 HTTP2Options
+
+	// ConnState is called when a client connection changes state, see OnConnState.
+	ConnState ConnStateHook
+
 	// Logger is the logger instance for logging server events.
 	Logger *log.Logger
 
-	// NewHandler determines whether the server uses the new handler functions or the old ones.
-	NewHandler bool
+	// CollectConfigErrors determines whether configuration problems are collected and returned by
+	// Validate and Run, instead of ending the process as soon as they are found.
+	CollectConfigErrors bool
+
+	// MaxBodyBytes is the maximum size of a request body read by the ContextHandler decoding helpers.
+	// Zero uses DefaultMaxBodyBytes and a negative value disables the limit.
+	// Routes can override it with the BodyLimit middleware.
+	MaxBodyBytes int64
+
+	// StrictJSON determines whether DecodeJSON rejects fields unknown to the target struct.
+	StrictJSON bool
+
+	// ErrorRenderer writes the response for errors passed to ContextHandler.Error, returned by handlers
+	// wrapped with HandlerWrapperE, and for unmatched requests. DefaultErrorRenderer is used when nil.
+	ErrorRenderer ErrorRenderer
+
+	// JSONOptions configures the JSON responses: indentation, HTML escaping, marshaller and JSONP.
+	JSONOptions JSONOptions
+
+	// WebSocketOptions configures the WebSocket endpoints: origin checks, subprotocols, compression and limits.
+	WebSocketOptions WSOptions
+
+	// TLS configures HTTPS: certificates, minimum version, cipher suites, client certificates and the redirect listener.
+	TLS TLSOptions
+
+	// ShutdownSignals are the signals triggering a graceful shutdown (os.Interrupt and SIGTERM when empty).
+	ShutdownSignals []os.Signal
+
+	// DrainTimeout is how long in-flight requests may run once shutdown started before they are forcibly closed (30s when 0).
+	DrainTimeout time.Duration
+
+	// ReadinessDelay is how long the server keeps serving after reporting not ready, so that load balancers
+	// stop sending traffic before the listener closes.
+	ReadinessDelay time.Duration
+
+	// GracefulRestart makes Run restart the server without refusing connections when one of the RestartSignals
+	// is received: the executable is started again with the listening sockets, and this process is drained.
+	GracefulRestart bool
+
+	// RestartSignals are the signals triggering a graceful restart (SIGHUP and SIGUSR2 when empty).
+	RestartSignals []os.Signal
+
+	// RestartTimeout is how long a graceful restart waits for the new process to be ready (30s when 0).
+	RestartTimeout time.Duration
+
+	// Config is the loader the options were loaded with, set by ConfigLoader.Load. The effective
+	// configuration is logged when the server starts, with secrets redacted.
+	Config *ConfigLoader
+
+	// NewHandler hints that the server mainly uses ContextHandler functions.
+	//
+	// Deprecated: standard and ContextHandler routes and middleware can be mixed on the same
+	// server, so the option no longer changes the behaviour of the server.
+	NewHandler bool `config:"-"`
 }
 
 // NewMyAPIServer creates a new instance of MyAPIServer with the provided optional parameters.
@@ -114,6 +366,9 @@ func NewMyAPIServer(opts *OptionalParams) *MyAPIServer {
 	// Set port based on the provided options
 	SetPort(opts, api)
 
+	// Set additional listeners based on the provided options
+	SetListeners(opts, api)
+
 	// Set DNS based on the provided options
 	SetDNS(opts, api)
 
@@ -138,15 +393,163 @@ func NewMyAPIServer(opts *OptionalParams) *MyAPIServer {
 	// Set logger based on the provided options
 	SetLogger(opts, api)
 
+	// Set request body size limit based on the provided options
+	SetMaxBodyBytes(opts, api)
+
+	// Set strict JSON decoding based on the provided options
+	SetStrictJSON(opts, api)
+
+	// Set JSON response options based on the provided options
+	SetJSONOptions(opts, api)
+
+	// Set WebSocket options based on the provided options
+	SetWebSocketOptions(opts, api)
+
+	// Set error renderer based on the provided options
+	SetErrorRenderer(opts, api)
+
+	// Set configuration error collection based on the provided options
+	SetCollectConfigErrors(opts, api)
+
+	// Set TLS options based on the provided options, reporting unusable certificates as configuration errors
+	SetTLS(opts, api)
+
+	// Set HTTP/2, header limits and connection hooks based on the provided options
+	SetProtocols(opts, api)
+
+	// Set graceful shutdown signals and timeouts based on the provided options
+	SetShutdown(opts, api)
+
+	// Set graceful restart signals and timeout based on the provided options
+	SetRestart(opts, api)
+
+	// Set the configuration loader based on the provided options
+	SetConfig(opts, api)
+
 	// Set new handler flag based on the provided options
 	SetNewHandler(opts, api)
 
 	// Create a new MyServer instance with a new ServeMux
 	api.Serv = &MyServer{ServeMux: http.NewServeMux()}
+	api.done = make(chan struct{})
 
 	return api
 }
 
+func SetMaxBodyBytes(opts *OptionalParams, api *MyAPIServer) {
+	if opts.MaxBodyBytes == 0 {
+		api.MaxBodyBytes = DefaultMaxBodyBytes
+	} else {
+		api.MaxBodyBytes = opts.MaxBodyBytes
+	}
+}
+
+func SetStrictJSON(opts *OptionalParams, api *MyAPIServer) {
+	api.StrictJSON = opts.StrictJSON
+}
+
+func SetJSONOptions(opts *OptionalParams, api *MyAPIServer) {
+	api.JSONOptions = opts.JSONOptions
+}
+
+func SetWebSocketOptions(opts *OptionalParams, api *MyAPIServer) {
+	api.WebSocketOptions = opts.WebSocketOptions
+	if api.WebSocketOptions.ReadLimit == 0 {
+		api.WebSocketOptions.ReadLimit = DefaultWSReadLimit
+	}
+	if api.WebSocketOptions.PingInterval == 0 {
+		api.WebSocketOptions.PingInterval = DefaultWSPingInterval
+	}
+	if api.WebSocketOptions.WriteTimeout == 0 {
+		api.WebSocketOptions.WriteTimeout = DefaultWSWriteTimeout
+	}
+	if api.WebSocketOptions.CloseTimeout <= 0 {
+		api.WebSocketOptions.CloseTimeout = DefaultWSCloseTimeout
+	}
+}
+
+func SetTLS(opts *OptionalParams, api *MyAPIServer) {
+	api.TLS = opts.TLS
+	if !api.TLS.enabled() {
+		return
+	}
+	if api.TLS.ReloadInterval == 0 {
+		api.TLS.ReloadInterval = DefaultCertReloadInterval
+	}
+	config, err := api.buildTLSConfig()
+	if err != nil {
+		api.configError(&ConfigError{Source: "SetTLS", Err: fmt.Errorf("%w: %v", ErrInvalidTLS, err)})
+		return
+	}
+	api.tlsConfig = config
+}
+
+func SetProtocols(opts *OptionalParams, api *MyAPIServer) {
+	api.ReadHeaderTimeout = opts.ReadHeaderTimeout
+	if api.ReadHeaderTimeout <= 0 {
+		api.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	api.MaxHeaderBytes = opts.MaxHeaderBytes
+	if api.MaxHeaderBytes <= 0 {
+		api.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+	api.H2C = opts.H2C
+	api.HTTP2 = opts.HTTP2
+	api.ConnState = opts.ConnState
+	if err := api.HTTP2.validate(); err != nil {
+		api.configError(&ConfigError{Source: "SetProtocols", Err: err})
+		api.HTTP2 = HTTP2Options{}
+		return
+	}
+	if api.tlsConfig != nil && api.HTTP2.enabled() {
+		// Report cipher suites unusable with HTTP/2 now rather than when serving
+		if err := http2.ConfigureServer(&http.Server{TLSConfig: api.tlsConfig.Clone()}, nil); err != nil {
+			api.configError(&ConfigError{Source: "SetProtocols", Err: fmt.Errorf("%w: %v", ErrInvalidHTTP2, err)})
+			api.HTTP2 = HTTP2Options{}
+		}
+	}
+}
+
+func SetShutdown(opts *OptionalParams, api *MyAPIServer) {
+	api.ShutdownSignals = opts.ShutdownSignals
+	if len(api.ShutdownSignals) == 0 {
+		api.ShutdownSignals = DefaultShutdownSignals
+	}
+	api.DrainTimeout = opts.DrainTimeout
+	if api.DrainTimeout <= 0 {
+		api.DrainTimeout = DefaultDrainTimeout
+	}
+	api.ReadinessDelay = opts.ReadinessDelay
+}
+
+func SetRestart(opts *OptionalParams, api *MyAPIServer) {
+	api.GracefulRestart = opts.GracefulRestart
+	api.RestartSignals = opts.RestartSignals
+	if len(api.RestartSignals) == 0 {
+		api.RestartSignals = DefaultRestartSignals
+	}
+	api.RestartTimeout = opts.RestartTimeout
+	if api.RestartTimeout <= 0 {
+		api.RestartTimeout = DefaultRestartTimeout
+	}
+}
+
+func SetConfig(opts *OptionalParams, api *MyAPIServer) {
+	api.Config = opts.Config
+}
+
+func SetErrorRenderer(opts *OptionalParams, api *MyAPIServer) {
+	if opts.ErrorRenderer == nil {
+		api.ErrorRenderer = DefaultErrorRenderer
+	} else {
+		api.ErrorRenderer = opts.ErrorRenderer
+	}
+}
+
+func SetCollectConfigErrors(opts *OptionalParams, api *MyAPIServer) {
+	api.CollectConfigErrors = opts.CollectConfigErrors
+}
+
 func SetNewHandler(opts *OptionalParams, api *MyAPIServer) {
 	if opts.NewHandler == false {
 		api.HandlerNew = false
@@ -219,6 +622,17 @@ func SetDNS(opts *OptionalParams, api *MyAPIServer) {
 	}
 }
 
+func SetListeners(opts *OptionalParams, api *MyAPIServer) {
+	api.Addrs = opts.Addrs
+	api.Listeners = opts.Listeners
+	api.UnixSocketMode = opts.UnixSocketMode
+	api.SystemdActivation = opts.SystemdActivation
+	if opts.Addr == "" && len(opts.Listeners) > 0 {
+		// Only serve on the provided listeners
+		api.Addr = ""
+	}
+}
+
 func SetPort(opts *OptionalParams, api *MyAPIServer) {
 	if opts.Addr == "" {
 		api.Addr = ":8080"
@@ -240,124 +654,239 @@ type ContextHandler struct {
 
 	// DNS is the domain name server information.
 	DNS string
+
+	// chain is the handler chain the context belongs to, used by Next and Abort.
+	chain *handlerChain
+
+	// api is the server handling the request, or nil for middleware wrapped outside of a server.
+	api *MyAPIServer
+}
+
+// newContextHandler creates a ContextHandler for the request whose chain runs the given handlers.
+func (api *MyAPIServer) newContextHandler(w http.ResponseWriter, r *http.Request, handlers ...func(ContextHandler)) ContextHandler {
+	return ContextHandler{
+		Writer:  wrapResponseWriter(w),
+		Request: r,
+		Logger:  api.Logger,
+		DNS:     api.Dns,
+		chain:   newHandlerChain(handlers...),
+		api:     api,
+	}
 }
 
 // handlerWrapper is a helper method that wraps a ContextHandler-based handler function into a standard http.HandlerFunc.
+// A nil handler results in a nil http.HandlerFunc, which is reported when the route is registered.
 func (api *MyAPIServer) handlerWrapper(handler func(ContextHandler)) http.HandlerFunc {
+	if handler == nil {
+		return nil
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Create a ContextHandler with the request and response writer
-		ctx := ContextHandler{
-			Writer:  w,
-			Request: r,
-			Logger:  api.Logger,
-			DNS:     api.Dns,
-		}
+		ctx := api.newContextHandler(w, r, handler)
 		// Call the handler function with the ContextHandler
-		handler(ctx)
+		ctx.Next()
+		// Send the status set with ctx.Status if the handler wrote no body
+		ctx.writePendingStatus()
 	}
 }
 
+// register wraps the handler with the route middleware and registers it with the ServeMux.
+// The first middleware in the list is the outermost one.
+// Invalid routes are reported as configuration problems instead of being registered.
+func (api *MyAPIServer) register(method string, pattern string, handler http.Handler, middlewares []MiddlewareConvertedN) {
+	if !api.checkRoute(method, pattern, handler, middlewares) {
+		return
+	}
+	if len(middlewares) > 0 {
+		handler = api.MiddlewareChainN(middlewares)(handler)
+	}
+	if !api.handleMux(method, pattern, handler) {
+		return
+	}
+	api.Serv.Routes = append(api.Serv.Routes, Route{Method: method, Pattern: pattern})
+}
+
 func (api *MyAPIServer) AddPrefix(prefix string) {
+	if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+		api.configError(&ConfigError{Source: "AddPrefix", Pattern: prefix, Err: ErrInvalidPrefix})
+		return
+	}
 	v1 := http.NewServeMux()
 	prefix2 := prefix[:len(prefix)-1]
-	v1.Handle(prefix, http.StripPrefix(prefix2, api.Serv.ServeMux))
+	v1.Handle(prefix, http.StripPrefix(prefix2, api.routeHandler(api.Serv.ServeMux)))
 	api.Serv.PrefixServeMux = v1
 }
 
+// Run starts the server and blocks until one of the ShutdownSignals is received, then shuts it down
+// gracefully. With GracefulRestart, one of the RestartSignals hands the listeners over to a new process
+// of the executable, see Restart, then shuts this one down the same way. It returns configuration and bind
+// errors, the error that stopped the server, or nil after a clean shutdown. Use RunContext, or Start and
+// Stop, to control the server without signals.
 func (api *MyAPIServer) Run() error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, api.ShutdownSignals...)
+	defer signal.Stop(sigChan)
+
+	// A nil channel never receives, leaving restarts disabled
+	var restartChan chan os.Signal
+	if api.GracefulRestart && len(api.RestartSignals) > 0 {
+		restartChan = make(chan os.Signal, 1)
+		signal.Notify(restartChan, api.RestartSignals...)
+		defer signal.Stop(restartChan)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				api.Logger.Println("Stopping server as per user interrupt", sig)
+				cancel()
+				return
+			case sig := <-restartChan:
+				api.Logger.Println("Restarting server as per signal", sig)
+				if err := api.handOver(); err != nil {
+					api.Logger.Printf("Restart failed, still serving: %v", err)
+					continue
+				}
+				// RunContext drains this process
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return api.RunContext(ctx)
+}
+
+// ShutDown stops the server gracefully: it reports not ready and keeps serving for ReadinessDelay,
+// runs the BeforeShutdown hooks, closes the event streams and WebSocket connections, then waits up to
+// DrainTimeout for the in-flight requests. Requests still running at the deadline are logged and their
+// connections forcibly closed. The AfterShutdown hooks run last. The returned error joins every failure.
+func (api *MyAPIServer) ShutDown(err error, prodServer *http.Server) error {
+	return api.shutdown(context.Background(), prodServer)
+}
+
+// shutdown stops the server gracefully as described by ShutDown, within the context.
+func (api *MyAPIServer) shutdown(ctx context.Context, prodServer *http.Server) error {
 	var err error
-	var servM http.Handler
 
-	if api.HandlerNew {
-		servM = api.NewServMConfigure(servM)
-	} else {
-		servM = api.OldServMConfigure(servM)
+	// Let load balancers notice the server is going away while it still answers
+	api.SetReady(false)
+	if api.ReadinessDelay > 0 {
+		api.Logger.Printf("Not ready, draining in %v", api.ReadinessDelay)
+		select {
+		case <-time.After(api.ReadinessDelay):
+		case <-ctx.Done():
+		}
 	}
-	api.Logger.Println("servM configured")
 
-	//Define server
-	prodServer := api.ConfigureServer(servM)
-	api.Logger.Println("prodServer configured")
+	tc, cancel := context.WithTimeout(ctx, api.DrainTimeout)
+	defer cancel()
+	errs := []error{api.runShutdownHooks(tc, "before shutdown", api.beforeShutdown)}
 
-	//call to serve
-	if err = api.StartServer(err, prodServer); err != nil {
-		return err
+	// End the event streams, which would otherwise keep their connections active until the timeout
+	if api.sseBroker != nil {
+		api.sseBroker.Close()
+	}
+	// Hijacked WebSocket connections are not tracked by http.Server: close them first
+	if api.wsHub != nil {
+		if err := api.wsHub.Shutdown(tc); err != nil {
+			api.Logger.Printf("closing websocket connections: %v", err)
+		}
+	}
+	if api.certReloader != nil {
+		api.certReloader.close()
+	}
+	if api.redirectServer != nil {
+		api.redirectServer.Shutdown(tc)
 	}
-	sig := api.ListenForInterrupt()
-
-	api.Logger.Println("Stopping server as per user interrupt", sig)
-	err = api.ShutDown(err, prodServer)
-	return err
-}
 
-func (api *MyAPIServer) ShutDown(err error, prodServer *http.Server) error {
-	tc, _ := context.WithTimeout(context.Background(), 30*time.Second)
-	err = prodServer.Shutdown(tc)
-	if err != nil {
+	if err = prodServer.Shutdown(tc); err != nil {
+		// The deadline was reached: report what is still running and close it
+		running := api.reportInFlight()
+		err = fmt.Errorf("draining requests: %w (%d still running)", err, len(running))
 		api.Logger.Println(err)
-		return err
+		if closeErr := prodServer.Close(); closeErr != nil {
+			api.Logger.Printf("closing server: %v", closeErr)
+		}
+		errs = append(errs, err)
 	}
-	return err
+
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), api.DrainTimeout)
+	defer hookCancel()
+	errs = append(errs, api.runShutdownHooks(hookCtx, "after shutdown", api.afterShutdown))
+	return errors.Join(errs...)
 }
 
+// ListenForInterrupt blocks until one of the ShutdownSignals is received and returns it.
 func (api *MyAPIServer) ListenForInterrupt() os.Signal {
+	signals := api.ShutdownSignals
+	if len(signals) == 0 {
+		signals = DefaultShutdownSignals
+	}
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, signals...)
+	defer signal.Stop(sigChan)
 	sig := <-sigChan
 	return sig
 }
 
+// StartServer binds the listener of the server and serves in the background with the provided http.Server,
+// returning bind errors directly. Errors while serving are reported by Done and Err.
 func (api *MyAPIServer) StartServer(err error, prodServer *http.Server) error {
-	go func() {
-		myFigure := figure.NewFigure(api.AppName, "", true)
-		myFigure.Print()
-		api.Logger.Printf("version: %v", api.AppVer)
-		api.Logger.Printf("Author: %v", api.AppAuthor)
-		api.Logger.Printf("Starting server at port %v", api.Addr)
-		if err = prodServer.ListenAndServe(); err != nil {
-			api.Logger.Printf("Error starting server %v", err)
-			os.Exit(1)
-		}
-	}()
-	return err
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	return api.startServer(prodServer)
 }
 
 func (api *MyAPIServer) ConfigureServer(servM http.Handler) *http.Server {
+	// The server gets a copy of the TLS configuration, to which HTTP/2 support adds its protocols
 	prodServer := &http.Server{
-		Addr:         api.Addr,
-		Handler:      servM,
-		ReadTimeout:  api.ReadTimeout,
-		WriteTimeout: api.WriteTimeout,
-		IdleTimeout:  api.IdleTimeout,
-		ErrorLog:     api.Logger,
+		Addr:              api.Addr,
+		Handler:           servM,
+		ReadTimeout:       api.ReadTimeout,
+		ReadHeaderTimeout: api.ReadHeaderTimeout,
+		WriteTimeout:      api.WriteTimeout,
+		IdleTimeout:       api.IdleTimeout,
+		MaxHeaderBytes:    api.MaxHeaderBytes,
+		ErrorLog:          api.Logger,
+		TLSConfig:         api.tlsConfig.Clone(),
+		ConnState:         api.connState(),
 	}
+
+	// Apply the HTTP/2 options and serve h2c if enabled
+	api.configureHTTP2(prodServer)
 	return prodServer
 }
 
-func (api *MyAPIServer) OldServMConfigure(servM http.Handler) http.Handler {
-	//get registered middleware
-	middlewareChain := api.MiddlewareChain(api.Serv.MiddlewareList)
-
-	//get final middleware
-
-	if api.Serv.PrefixServeMux != nil && api.Serv.MiddlewareList != nil {
-		servM = middlewareChain(api.Serv.PrefixServeMux)
-	} else if api.Serv.ServeMux != nil && api.Serv.MiddlewareList != nil {
-		servM = middlewareChain(api.Serv.ServeMux)
-	} else {
-		servM = api.Serv.ServeMux
+// ServMConfigure returns the root handler of the server: the ServeMux, or the PrefixServeMux when
+// a prefix was added, wrapped with the server middleware of both styles in the order they were added.
+// Requests matching no route are answered with 404 or 405 by the NotFound and MethodNotAllowed hooks,
+// or through the error renderer when no hook is set.
+func (api *MyAPIServer) ServMConfigure(servM http.Handler) http.Handler {
+	servM = api.routeHandler(api.Serv.ServeMux)
+	if api.Serv.PrefixServeMux != nil {
+		servM = api.routeHandler(api.Serv.PrefixServeMux)
+	}
+	if middlewares := api.Serv.middlewares(); len(middlewares) > 0 {
+		servM = api.MiddlewareChainN(middlewares)(servM)
 	}
-	return servM
+	return api.trackInFlight(servM)
 }
 
+// OldServMConfigure returns the root handler of the server.
+//
+// Deprecated: use ServMConfigure, which applies middleware of both styles.
+func (api *MyAPIServer) OldServMConfigure(servM http.Handler) http.Handler {
+	return api.ServMConfigure(servM)
+}
+
+// NewServMConfigure returns the root handler of the server.
+//
+// Deprecated: use ServMConfigure, which applies middleware of both styles.
 func (api *MyAPIServer) NewServMConfigure(servM http.Handler) http.Handler {
-	middlewareChainN := api.MiddlewareChainN(api.Serv.MiddlewareListN)
-	if api.Serv.PrefixServeMux != nil && api.Serv.MiddlewareListN != nil {
-		servM = middlewareChainN(api.Serv.PrefixServeMux)
-	} else if api.Serv.ServeMux != nil && api.Serv.MiddlewareListN != nil {
-		servM = middlewareChainN(api.Serv.ServeMux)
-	} else {
-		servM = api.Serv.ServeMux
-	}
-	return servM
+	return api.ServMConfigure(servM)
 }
@@ -0,0 +1,293 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxMultipartMemory is the maximum number of bytes of a multipart form kept in memory by BindForm,
+// the remaining parts being stored in temporary files.
+var MaxMultipartMemory int64 = 32 << 20
+
+var (
+	// ErrBindTarget is returned when a binding method is called with something other than a pointer to a struct.
+	ErrBindTarget = errors.New("bind target must be a non-nil pointer to a struct")
+
+	// ErrUnsupportedMediaType is returned by Bind when the request Content-Type cannot be decoded.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// errInvalidUUID is the conversion error used for values that are not UUIDs.
+	errInvalidUUID = errors.New("invalid UUID")
+
+	// textUnmarshalerType is the reflect.Type of encoding.TextUnmarshaler.
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// timeType is the reflect.Type of time.Time.
+	timeType = reflect.TypeOf(time.Time{})
+
+	// fileHeaderType is the reflect.Type of *multipart.FileHeader.
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// BindQuery fills the fields of the struct pointed to by v from the URL query parameters,
+// using the field tag `query:"name"` to select the parameter.
+func (ctx *ContextHandler) BindQuery(v interface{}) error {
+	query := ctx.Request.URL.Query()
+	return bindValues(v, "query", func(name string) ([]string, bool) {
+		values, ok := query[name]
+		return values, ok
+	}, nil)
+}
+
+// BindHeader fills the fields of the struct pointed to by v from the request headers,
+// using the field tag `header:"name"` to select the header. Header names are case-insensitive.
+func (ctx *ContextHandler) BindHeader(v interface{}) error {
+	return bindValues(v, "header", func(name string) ([]string, bool) {
+		values := ctx.Request.Header.Values(name)
+		return values, len(values) > 0
+	}, nil)
+}
+
+// BindForm fills the fields of the struct pointed to by v from an URL-encoded or multipart form body,
+// using the field tag `form:"name"` to select the form field. Uploaded files can be bound to
+// fields of type *multipart.FileHeader or []*multipart.FileHeader.
+func (ctx *ContextHandler) BindForm(v interface{}) error {
+	var files map[string][]*multipart.FileHeader
+	ctx.limitBody()
+	if mediaType(ctx.Request) == "multipart/form-data" {
+		if err := ctx.Request.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			return ctx.bodyError(nil, err)
+		}
+		files = ctx.Request.MultipartForm.File
+	} else if err := ctx.Request.ParseForm(); err != nil {
+		return ctx.bodyError(nil, err)
+	}
+	return bindValues(v, "form", func(name string) ([]string, bool) {
+		values, ok := ctx.Request.PostForm[name]
+		return values, ok
+	}, files)
+}
+
+// Bind decodes the request body into v, choosing the decoder from the Content-Type header:
+// JSON bodies, including +json media types, are decoded with DecodeJSON, URL-encoded or multipart forms with BindForm and
+// other media types with the decoder registered on the server, see Decode.
+// Requests without a body are bound from the URL query parameters with BindQuery.
+// It returns ErrUnsupportedMediaType when no decoder matches the Content-Type.
+func (ctx *ContextHandler) Bind(v interface{}) error {
+	switch media := mediaType(ctx.Request); {
+	case media == MediaTypeJSON || strings.HasSuffix(media, "+json"):
+		return ctx.DecodeJSON(v)
+	case media == "application/x-www-form-urlencoded" || media == "multipart/form-data":
+		return ctx.BindForm(v)
+	case media == "":
+		if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody || ctx.Request.ContentLength == 0 {
+			return ctx.BindQuery(v)
+		}
+		return ErrUnsupportedMediaType
+	}
+	return ctx.Decode(v)
+}
+
+// mediaType returns the media type of the request Content-Type header, in lower case and without parameters.
+func mediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(contentType)
+	}
+	return media
+}
+
+// bindValues fills the fields of the struct pointed to by v from the values returned by lookup,
+// using the field tag with the given name to select the value of each field.
+// The tag name is also used as the location of the parameter in the returned ParamError.
+//
+// The following field tags are supported next to the lookup tag:
+//   - default:"value" is used when no value is found; slices split it on commas.
+//   - time_format:"layout" is the layout used to parse time.Time fields, time.RFC3339 by default.
+//
+// Embedded structs are bound as if their fields belonged to the outer struct.
+func bindValues(v interface{}, tag string, lookup func(name string) ([]string, bool), files map[string][]*multipart.FileHeader) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+	return bindStruct(target.Elem(), tag, lookup, files)
+}
+
+// bindStruct fills the fields of the struct value, recursing into embedded structs.
+func bindStruct(target reflect.Value, tag string, lookup func(name string) ([]string, bool), files map[string][]*multipart.FileHeader) error {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		name := field.Tag.Get(tag)
+
+		// Embedded structs without a tag of their own are bound field by field
+		if field.Anonymous && name == "" {
+			embedded := target.Field(i)
+			if embedded.Kind() == reflect.Pointer && embedded.Type().Elem().Kind() == reflect.Struct {
+				if !embedded.CanSet() {
+					continue
+				}
+				if embedded.IsNil() {
+					embedded.Set(reflect.New(embedded.Type().Elem()))
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := bindStruct(embedded, tag, lookup, files); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		// Uploaded files are only available for multipart forms
+		if isFileField(field.Type) {
+			setFileField(target.Field(i), files[name])
+			continue
+		}
+
+		values, ok := lookup(name)
+		if !ok || len(values) == 0 {
+			defaultValue, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
+				continue
+			}
+			values = []string{defaultValue}
+			if field.Type.Kind() == reflect.Slice {
+				values = strings.Split(defaultValue, ",")
+			}
+		}
+		if err := setValues(target.Field(i), values, field.Tag.Get("time_format")); err != nil {
+			return &ParamError{In: tag, Name: name, Value: strings.Join(values, ","), Type: field.Type.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// setValues stores the values in the field, converting them to the field type.
+// Slices receive every value, pointers are allocated and other fields receive the first value.
+func setValues(field reflect.Value, values []string, timeFormat string) error {
+	switch {
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValues(slice.Index(i), []string{value}, timeFormat); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	case field.Kind() == reflect.Pointer:
+		elem := reflect.New(field.Type().Elem())
+		if err := setValues(elem.Elem(), values, timeFormat); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	return setField(field, values[0], timeFormat)
+}
+
+// setField converts the raw value to the type of the field and stores it in the field.
+func setField(field reflect.Value, value string, timeFormat string) error {
+	// Times use the layout given by the time_format tag
+	if field.Type() == timeType {
+		if timeFormat == "" {
+			timeFormat = time.RFC3339
+		}
+		t, err := time.Parse(timeFormat, value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	// Types such as UUIDs or IP addresses convert themselves
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Durations are accepted in the time.ParseDuration format
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		// Only byte slices reach this point, other slices are handled by setValues
+		field.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// isFileField reports whether the field type receives uploaded files.
+func isFileField(t reflect.Type) bool {
+	return t == fileHeaderType || (t.Kind() == reflect.Slice && t.Elem() == fileHeaderType)
+}
+
+// setFileField stores the uploaded files in a *multipart.FileHeader or []*multipart.FileHeader field.
+func setFileField(field reflect.Value, files []*multipart.FileHeader) {
+	if len(files) == 0 {
+		return
+	}
+	if field.Kind() == reflect.Slice {
+		field.Set(reflect.ValueOf(files))
+		return
+	}
+	field.Set(reflect.ValueOf(files[0]))
+}
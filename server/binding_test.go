@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// paging is embedded in the binding targets.
+type paging struct {
+	Page  int `query:"page" form:"page" json:"page" default:"1"`
+	Limit int `query:"limit" form:"limit" json:"limit" default:"20"`
+}
+
+// searchRequest is a binding target using every supported field kind.
+type searchRequest struct {
+	paging
+	Query   string     `query:"q" form:"q" header:"X-Query" json:"q"`
+	Tags    []string   `query:"tag" form:"tag" header:"X-Tag" json:"tags" default:"a,b"`
+	Exact   bool       `query:"exact" form:"exact" json:"exact"`
+	MinRank *uint      `query:"min_rank" form:"min_rank" json:"min_rank"`
+	Score   float64    `query:"score" form:"score" json:"score"`
+	Since   time.Time  `query:"since" form:"since" header:"X-Since" time_format:"2006-01-02" json:"since"`
+	Until   *time.Time `query:"until" json:"until"`
+	Ignored string     `query:"-"`
+}
+
+// serveBind serves the request on a POST and GET route and returns the result of bind.
+func serveBind(t *testing.T, r *http.Request, bind func(ctx *ContextHandler, v interface{}) error) (searchRequest, error) {
+	t.Helper()
+	api := newTestServer(t, nil)
+	var (
+		got searchRequest
+		err error
+	)
+	handler := func(ctx ContextHandler) { err = bind(&ctx, &got) }
+	api.GetN("/search", handler)
+	api.PostN("/search", handler)
+	api.ServMConfigure(nil).ServeHTTP(httptest.NewRecorder(), r)
+	return got, err
+}
+
+func uintPointer(u uint) *uint { return &u }
+
+func TestBindQuery(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		query     string
+		want      searchRequest
+		wantParam string
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  searchRequest{paging: paging{Page: 1, Limit: 20}, Tags: []string{"a", "b"}},
+		},
+		{
+			name:  "every kind",
+			query: "q=go&tag=x&tag=y&exact=true&min_rank=3&score=0.5&since=2024-03-01&until=2024-03-02T10:00:00Z&page=2&Ignored=x",
+			want: searchRequest{
+				paging:  paging{Page: 2, Limit: 20},
+				Query:   "go",
+				Tags:    []string{"x", "y"},
+				Exact:   true,
+				MinRank: uintPointer(3),
+				Score:   0.5,
+				Since:   since,
+				Until:   &until,
+			},
+		},
+		{name: "invalid int", query: "page=two", wantParam: "page"},
+		{name: "negative uint", query: "min_rank=-1", wantParam: "min_rank"},
+		{name: "invalid bool", query: "exact=maybe", wantParam: "exact"},
+		{name: "invalid time", query: "since=01/03/2024", wantParam: "since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serveBind(t, httptest.NewRequest(http.MethodGet, "/search?"+tt.query, nil), (*ContextHandler).BindQuery)
+			if tt.wantParam != "" {
+				var paramErr *ParamError
+				if !errors.As(err, &paramErr) || paramErr.In != "query" || paramErr.Name != tt.wantParam {
+					t.Fatalf("BindQuery = %v, want a ParamError for %s", err, tt.wantParam)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BindQuery = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	r.Header.Set("x-query", "go")
+	r.Header.Add("X-Tag", "x")
+	r.Header.Add("X-Tag", "y")
+	r.Header.Set("X-Since", "2024-03-01")
+	got, err := serveBind(t, r, (*ContextHandler).BindHeader)
+	want := searchRequest{Query: "go", Tags: []string{"x", "y"}, Since: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("BindHeader = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("q", "go")
+	mw.WriteField("tag", "x")
+	mw.WriteField("tag", "y")
+	part, _ := mw.CreateFormFile("upload", "notes.txt")
+	part.Write([]byte("notes"))
+	mw.Close()
+
+	type upload struct {
+		Query  string                `form:"q"`
+		Tags   []string              `form:"tag"`
+		Upload *multipart.FileHeader `form:"upload"`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantFile    string
+	}{
+		{name: "urlencoded", contentType: "application/x-www-form-urlencoded", body: "q=go&tag=x&tag=y"},
+		{name: "multipart", contentType: mw.FormDataContentType(), body: multipartBody.String(), wantFile: "notes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			var (
+				got upload
+				err error
+			)
+			api.PostN("/upload", func(ctx ContextHandler) {
+				if err = ctx.BindForm(&got); err != nil || got.Upload == nil {
+					return
+				}
+				file, _ := got.Upload.Open()
+				content, _ := io.ReadAll(file)
+				file.Close()
+				if string(content) != tt.wantFile {
+					t.Errorf("uploaded file = %q, want %q", content, tt.wantFile)
+				}
+			})
+			r := httptest.NewRequest(http.MethodPost, "/upload?q=query", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			api.ServMConfigure(nil).ServeHTTP(httptest.NewRecorder(), r)
+
+			if err != nil || got.Query != "go" || strings.Join(got.Tags, ",") != "x,y" {
+				t.Errorf("BindForm = %+v, %v", got, err)
+			}
+			if (got.Upload != nil) != (tt.wantFile != "") {
+				t.Errorf("Upload = %v, want file %v", got.Upload, tt.wantFile != "")
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantQuery   string
+		wantErr     error
+	}{
+		{name: "json", method: http.MethodPost, target: "/search", contentType: "application/json; charset=utf-8", body: `{"q":"json"}`, wantQuery: "json"},
+		{name: "json suffix", method: http.MethodPost, target: "/search", contentType: "application/problem+json", body: `{"q":"problem"}`, wantQuery: "problem"},
+		{name: "form", method: http.MethodPost, target: "/search", contentType: "application/x-www-form-urlencoded", body: "q=form", wantQuery: "form"},
+		{name: "no body", method: http.MethodGet, target: "/search?q=query", wantQuery: "query"},
+		{name: "body without content type", method: http.MethodPost, target: "/search", body: "q=form", wantErr: ErrUnsupportedMediaType},
+		{name: "unknown content type", method: http.MethodPost, target: "/search", contentType: "text/csv", body: "q,form", wantErr: ErrUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			got, err := serveBind(t, r, (*ContextHandler).Bind)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Bind = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Query != tt.wantQuery {
+				t.Errorf("Query = %q, want %q", got.Query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestBindTarget(t *testing.T) {
+	var (
+		notPointer searchRequest
+		nilPointer *searchRequest
+		notStruct  string
+	)
+	for _, v := range []interface{}{notPointer, nilPointer, &notStruct, nil} {
+		if err := bindValues(v, "query", func(string) ([]string, bool) { return nil, false }, nil); !errors.Is(err, ErrBindTarget) {
+			t.Errorf("bindValues(%T) = %v, want ErrBindTarget", v, err)
+		}
+	}
+}
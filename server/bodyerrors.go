@@ -0,0 +1,122 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxBodyBytes is the request body size limit used when OptionalParams.MaxBodyBytes is not set.
+var DefaultMaxBodyBytes int64 = 10 << 20
+
+var (
+	// ErrBodyTooLarge is reported when the request body exceeds the configured size limit.
+	ErrBodyTooLarge = errors.New("request body too large")
+
+	// ErrEmptyBody is reported when the request body is empty.
+	ErrEmptyBody = errors.New("request body is empty")
+
+	// ErrSyntax is reported when the request body is not well-formed.
+	ErrSyntax = errors.New("malformed request body")
+
+	// ErrFieldType is reported when a value of the request body has the wrong type for its field.
+	ErrFieldType = errors.New("invalid field type")
+
+	// ErrUnknownField is reported in strict mode when the request body contains a field unknown to the target.
+	ErrUnknownField = errors.New("unknown field")
+
+	// ErrTrailingData is reported when the request body contains data after the first JSON value.
+	ErrTrailingData = errors.New("unexpected data after the JSON value")
+)
+
+// contextKey is the type of the request context keys used by the package.
+type contextKey string
+
+// bodyLimitKey is the request context key holding the original request body once a size limit has been applied.
+const bodyLimitKey contextKey = "bodyLimit"
+
+// BodyError describes a request body that could not be read or decoded.
+type BodyError struct {
+	// Kind is the category of the error, one of the ErrBodyTooLarge, ErrEmptyBody, ErrSyntax,
+	// ErrFieldType, ErrUnknownField or ErrTrailingData variables.
+	Kind error
+
+	// Offset is the position in the body where the error was found, if known.
+	Offset int64
+
+	// Field is the name of the field concerned by ErrFieldType and ErrUnknownField errors.
+	Field string
+
+	// Limit is the body size limit, for ErrBodyTooLarge errors.
+	Limit int64
+
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error returns a description of the body error.
+func (e *BodyError) Error() string {
+	switch {
+	case e.Kind == ErrBodyTooLarge:
+		return fmt.Sprintf("%v: limit is %d bytes", e.Kind, e.Limit)
+	case e.Field != "":
+		return fmt.Sprintf("%v %q at offset %d", e.Kind, e.Field, e.Offset)
+	case e.Kind == ErrSyntax || e.Kind == ErrTrailingData:
+		return fmt.Sprintf("%v at offset %d", e.Kind, e.Offset)
+	}
+	return e.Kind.Error()
+}
+
+// Unwrap returns the kind and the underlying error so that errors.Is can be used with both.
+func (e *BodyError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// StatusCode returns the HTTP status code matching the error:
+// 413 Request Entity Too Large for ErrBodyTooLarge and 400 Bad Request otherwise.
+func (e *BodyError) StatusCode() int {
+	if e.Kind == ErrBodyTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// BodyLimit returns a middleware setting the request body size limit of the routes it is applied to,
+// overriding the server-wide MaxBodyBytes and any BodyLimit applied further out, e.g. on a group.
+// A negative limit disables the limit.
+func BodyLimit(limit int64) Middleware {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, limitRequestBody(w, r, limit))
+		}
+	}
+}
+
+// BodyLimitN is the ContextHandler middleware equivalent of BodyLimit, for use with the N registration methods.
+func BodyLimitN(limit int64) MiddlewareN {
+	return func(ctx ContextHandler) {
+		ctx.Request = limitRequestBody(ctx.Writer, ctx.Request, limit)
+		ctx.Next()
+	}
+}
+
+// limitRequestBody returns the request with its body limited to the given size, replacing any previous limit.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) *http.Request {
+	body := r.Body
+	if original, ok := r.Context().Value(bodyLimitKey).(io.ReadCloser); ok {
+		body = original
+	}
+	r.Body = body
+	if limit > 0 && body != nil {
+		r.Body = http.MaxBytesReader(w, body, limit)
+	}
+	return r.WithContext(context.WithValue(r.Context(), bodyLimitKey, body))
+}
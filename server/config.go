@@ -0,0 +1,603 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFileFlag is the name of the flag naming a configuration file, e.g. -config=/etc/app/config.yaml.
+const DefaultConfigFileFlag = "config"
+
+var (
+	// ErrInvalidConfig is reported for configuration values that cannot be parsed or are out of range.
+	ErrInvalidConfig = errors.New("invalid configuration value")
+
+	// ErrUnknownConfigKey is reported for configuration file keys matching no setting, usually typos.
+	ErrUnknownConfigKey = errors.New("unknown configuration key")
+
+	// ErrConfigFormat is reported for configuration files whose extension is not .yaml, .yml, .json or .toml.
+	ErrConfigFormat = errors.New("unsupported configuration file format")
+
+	// ErrConfigTarget is returned when a configuration extension is not a non-nil pointer to a struct.
+	ErrConfigTarget = errors.New("configuration target must be a non-nil pointer to a struct")
+
+	// fileModeType is the reflect.Type of os.FileMode, parsed as an octal number.
+	fileModeType = reflect.TypeOf(os.FileMode(0))
+
+	// secretNames are the parts of setting names whose values are redacted from Dump.
+	secretNames = []string{"password", "passwd", "secret", "token", "credential", "apikey", "privatekey"}
+)
+
+// ConfigLoader fills OptionalParams, and structs of the application extending them, from configuration files,
+// environment variables and command-line flags. Each source overrides the ones before it:
+//
+//  1. the values already in the structs, e.g. defaults set in code;
+//  2. the Files, in order, then the file named by the -config flag;
+//  3. the environment variables starting with EnvPrefix;
+//  4. the command-line flags in Args.
+//
+// Settings are named after the struct fields: ReadTimeout is read_timeout in files, APP_READ_TIMEOUT in the
+// environment with the "APP" prefix and -read-timeout on the command line. Nested structs add a level:
+// TLS.CertFile is cert_file in the tls section of files, APP_TLS_CERT_FILE and -tls-cert-file.
+// Fields of extension structs use the same rules and may set their own name with the `config:"name"` tag,
+// be skipped with `config:"-"` and be redacted from Dump with `config:",secret"`; their `usage` tag describes
+// the flag. Functions, interfaces and pointers, such as Logger or Listeners, are only set in code.
+//
+// Values use the formats of time.ParseDuration for durations, octal for file modes (0660) and commas to
+// separate the items of lists in the environment and flags. Extension structs are checked against their
+// `validate` tags, see MyAPIServer.ValidateStruct, and with their Validate method if they have one.
+type ConfigLoader struct {
+	// EnvPrefix is the prefix of the environment variables, e.g. "APP". The environment is not read when empty.
+	EnvPrefix string
+
+	// Files are the configuration files read in order, in YAML (.yaml, .yml), JSON (.json) or TOML (.toml).
+	Files []string
+
+	// FileFlag is the name of the flag naming one more configuration file, "config" when empty and disabled with "-".
+	FileFlag string
+
+	// Args are the command-line arguments parsed as flags, usually os.Args[1:]. Flags are not parsed when nil.
+	Args []string
+
+	// FlagSet receives the flags, so that the application can define its own next to them.
+	// A new flag set ending with an error on unknown flags is used when nil.
+	FlagSet *flag.FlagSet
+
+	// LookupEnv reads the environment variables, os.LookupEnv when nil.
+	LookupEnv func(key string) (string, bool)
+
+	// fields are the settings of the loaded structs, in declaration order.
+	fields []*configField
+
+	// sources records where each setting was last set, by key.
+	sources map[string]string
+}
+
+// configField is a setting: a field of a configuration struct holding a value.
+type configField struct {
+	// key is the dotted name of the setting, e.g. "tls.cert_file".
+	key string
+
+	// path is the key split into its parts, used for environment variables and flags.
+	path []string
+
+	// names are the Go field names leading to the field from its struct, used to find the effective value.
+	names []string
+
+	// value is the field itself, and target the index of its struct.
+	value  reflect.Value
+	target int
+
+	secret bool
+	usage  string
+}
+
+// Load fills opts, then the extension structs, from the sources in order of precedence, and validates the result.
+// It returns ConfigErrors listing every invalid or unknown setting, flag.ErrHelp when the flags ask for help,
+// or the error reading a configuration file. On success, opts.Config is set to the loader so that the server
+// logs the effective configuration when it starts.
+func (l *ConfigLoader) Load(opts *OptionalParams, extensions ...interface{}) error {
+	l.fields = nil
+	l.sources = make(map[string]string)
+	targets := append([]interface{}{opts}, extensions...)
+	for i, target := range targets {
+		value := reflect.ValueOf(target)
+		if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+			return ErrConfigTarget
+		}
+		l.collectFields(value.Elem(), i, nil, nil, false)
+	}
+
+	// Settings are found by a normalised key, so that files may use read_timeout, readTimeout or read-timeout
+	index := make(map[string]*configField, len(l.fields))
+	for _, field := range l.fields {
+		normalised := normaliseConfigKey(field.key)
+		if _, ok := index[normalised]; ok {
+			return fmt.Errorf("duplicate configuration key %q", field.key)
+		}
+		index[normalised] = field
+	}
+
+	var errs ConfigErrors
+	set := func(field *configField, values []string, source string) {
+		if err := setConfigValue(field.value, values); err != nil {
+			errs = append(errs, &ConfigError{Source: source, Err: fmt.Errorf("%w: %s: %v", ErrInvalidConfig, field.key, err)})
+			return
+		}
+		l.sources[field.key] = source
+	}
+
+	// Flags are parsed first to find the configuration file, and applied last
+	type flagValue struct {
+		field *configField
+		value string
+	}
+	var flagValues []flagValue
+	files := append([]string(nil), l.Files...)
+	if l.Args != nil {
+		flags := l.FlagSet
+		if flags == nil {
+			flags = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+		}
+		fileFlag := l.FileFlag
+		if fileFlag == "" {
+			fileFlag = DefaultConfigFileFlag
+		}
+		var file string
+		if fileFlag != "-" {
+			flags.StringVar(&file, fileFlag, "", "configuration file (YAML, JSON or TOML)")
+		}
+		for _, field := range l.fields {
+			field := field
+			record := func(value string) error {
+				flagValues = append(flagValues, flagValue{field: field, value: value})
+				return nil
+			}
+			if field.value.Kind() == reflect.Bool {
+				flags.BoolFunc(field.flagName(), field.flagUsage(l.EnvPrefix), record)
+			} else {
+				flags.Func(field.flagName(), field.flagUsage(l.EnvPrefix), record)
+			}
+		}
+		if err := flags.Parse(l.Args); err != nil {
+			return err
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	for _, file := range files {
+		settings, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		for _, setting := range settings {
+			field, ok := index[normaliseConfigKey(setting.key)]
+			if !ok {
+				errs = append(errs, &ConfigError{Source: "file " + file, Err: fmt.Errorf("%w: %s", ErrUnknownConfigKey, setting.key)})
+				continue
+			}
+			set(field, setting.values, "file "+file)
+		}
+	}
+
+	if l.EnvPrefix != "" {
+		lookupEnv := l.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+		for _, field := range l.fields {
+			name := field.envName(l.EnvPrefix)
+			if value, ok := lookupEnv(name); ok {
+				set(field, splitConfigList(field.value, value), "env "+name)
+			}
+		}
+	}
+
+	for _, flagValue := range flagValues {
+		set(flagValue.field, splitConfigList(flagValue.field.value, flagValue.value), "flag -"+flagValue.field.flagName())
+	}
+
+	// Values are only checked once every source has been applied
+	errs = append(errs, validateOptions(opts)...)
+	validator := &MyAPIServer{}
+	for _, extension := range extensions {
+		if err := validator.ValidateStruct(extension); err != nil {
+			errs = append(errs, &ConfigError{Source: "validate", Err: fmt.Errorf("%w: %v", ErrInvalidConfig, err)})
+		}
+		if v, ok := extension.(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				errs = append(errs, &ConfigError{Source: "validate", Err: fmt.Errorf("%w: %v", ErrInvalidConfig, err)})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	opts.Config = l
+	return nil
+}
+
+// collectFields records the settings of the struct value, recursing into nested and embedded structs.
+func (l *ConfigLoader) collectFields(value reflect.Value, target int, path []string, names []string, secret bool) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("config"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldSecret := secret || options == "secret"
+		fieldNames := append(append([]string(nil), names...), field.Name)
+
+		// Embedded structs without a name of their own share the level of the outer struct
+		fieldPath := path
+		if !field.Anonymous || name != "" {
+			if name == "" {
+				name = snakeCase(field.Name)
+			}
+			fieldPath = append(append([]string(nil), path...), name)
+		}
+
+		switch {
+		case configurable(field.Type):
+			key := strings.Join(fieldPath, ".")
+			l.fields = append(l.fields, &configField{
+				key:    key,
+				path:   fieldPath,
+				names:  fieldNames,
+				value:  value.Field(i),
+				target: target,
+				secret: fieldSecret || isSecretName(key),
+				usage:  field.Tag.Get("usage"),
+			})
+		case field.Type.Kind() == reflect.Struct:
+			l.collectFields(value.Field(i), target, fieldPath, fieldNames, fieldSecret)
+		}
+	}
+}
+
+// configurable reports whether fields of the type hold a value that can be read from text.
+func configurable(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && t.Elem().Kind() != reflect.Struct && configurable(t.Elem())
+	}
+	return false
+}
+
+// setConfigValue converts the values to the type of the field and stores them in it.
+func setConfigValue(field reflect.Value, values []string) error {
+	if field.Type() == fileModeType {
+		if len(values) != 1 {
+			return fmt.Errorf("expected a single value")
+		}
+		// Base 0 reads "0660" as octal, and numbers from files as they were decoded
+		mode, err := strconv.ParseUint(values[0], 0, 32)
+		if err != nil {
+			return err
+		}
+		field.SetUint(mode)
+		return nil
+	}
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+		if len(values) == 0 {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+			return nil
+		}
+		return setValues(field, values, "")
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("expected a single value, got a list")
+	}
+	return setValues(field, values, "")
+}
+
+// splitConfigList splits the value on commas for list fields, as used by environment variables and flags.
+func splitConfigList(field reflect.Value, value string) []string {
+	if field.Kind() != reflect.Slice || field.Type().Elem().Kind() == reflect.Uint8 {
+		return []string{value}
+	}
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// envName returns the environment variable of the setting, e.g. APP_TLS_CERT_FILE.
+func (f *configField) envName(prefix string) string {
+	return strings.ToUpper(strings.TrimSuffix(prefix, "_") + "_" + strings.Join(f.path, "_"))
+}
+
+// flagName returns the command-line flag of the setting, e.g. tls-cert-file.
+func (f *configField) flagName() string {
+	return strings.ReplaceAll(strings.Join(f.path, "-"), "_", "-")
+}
+
+// flagUsage returns the help text of the flag of the setting.
+func (f *configField) flagUsage(envPrefix string) string {
+	usage := f.usage
+	if usage == "" {
+		usage = f.key
+	}
+	usage += " (" + f.value.Type().String()
+	if envPrefix != "" {
+		usage += ", env " + f.envName(envPrefix)
+	}
+	return usage + ")"
+}
+
+// configSetting is a value read from a configuration file.
+type configSetting struct {
+	key    string
+	values []string
+}
+
+// readConfigFile reads the settings of a YAML, JSON or TOML file, in key order.
+func readConfigFile(file string) ([]configSetting, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	document := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &document)
+	case ".json":
+		// Numbers are kept as written, large integers included
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&document)
+	case ".toml":
+		err = toml.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrConfigFormat, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	var settings []configSetting
+	flattenConfig("", document, &settings)
+	return settings, nil
+}
+
+// flattenConfig turns the nested sections of a configuration file into dotted keys.
+func flattenConfig(prefix string, section map[string]interface{}, settings *[]configSetting) {
+	keys := make([]string, 0, len(section))
+	for key := range section {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, name := range keys {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch value := section[name].(type) {
+		case nil:
+			// Empty values keep the setting unchanged
+		case map[string]interface{}:
+			flattenConfig(key, value, settings)
+		case []interface{}:
+			values := make([]string, 0, len(value))
+			for _, item := range value {
+				values = append(values, configString(item))
+			}
+			*settings = append(*settings, configSetting{key: key, values: values})
+		default:
+			*settings = append(*settings, configSetting{key: key, values: []string{configString(value)}})
+		}
+	}
+}
+
+// configString formats a scalar decoded from a configuration file the way it would be written in a flag.
+func configString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// normaliseConfigKey makes keys written in snake_case, kebab-case or camelCase compare equal.
+func normaliseConfigKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms together: ClientCAFile is client_ca_file.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || (unicode.IsUpper(previous) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// isSecretName reports whether the setting name suggests a secret value, such as a password or a token.
+func isSecretName(key string) bool {
+	normalised := normaliseConfigKey(key)
+	for _, name := range secretNames {
+		if strings.Contains(normalised, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOptions checks the values of the options that the setters of NewMyAPIServer would otherwise
+// accept silently or only reject when the server starts.
+func validateOptions(opts *OptionalParams) ConfigErrors {
+	var errs ConfigErrors
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Source: "validate", Err: fmt.Errorf("%w: %s: %s", ErrInvalidConfig, key, fmt.Sprintf(format, args...))})
+	}
+
+	for i, addr := range append([]string{opts.Addr}, opts.Addrs...) {
+		key := "addr"
+		if i > 0 {
+			key = fmt.Sprintf("addrs[%d]", i-1)
+		}
+		if addr == "" && i == 0 {
+			continue
+		}
+		if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+			if path == "" {
+				invalid(key, "missing Unix socket path")
+			}
+			continue
+		}
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			invalid(key, "%v", err)
+			continue
+		}
+		if _, err := net.LookupPort("tcp", port); port != "" && err != nil {
+			invalid(key, "invalid port %q", port)
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"read_timeout", opts.ReadTimeout},
+		{"write_timeout", opts.WriteTimeout},
+		{"idle_timeout", opts.IdleTimeout},
+		{"read_header_timeout", opts.ReadHeaderTimeout},
+		{"drain_timeout", opts.DrainTimeout},
+		{"readiness_delay", opts.ReadinessDelay},
+		{"restart_timeout", opts.RestartTimeout},
+		{"web_socket_options.ping_interval", opts.WebSocketOptions.PingInterval},
+		{"web_socket_options.write_timeout", opts.WebSocketOptions.WriteTimeout},
+		{"web_socket_options.close_timeout", opts.WebSocketOptions.CloseTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			invalid(d.key, "negative duration %v", d.value)
+		}
+	}
+	if opts.MaxHeaderBytes < 0 {
+		invalid("max_header_bytes", "negative size %d", opts.MaxHeaderBytes)
+	}
+	if opts.UnixSocketMode&^os.ModePerm != 0 {
+		invalid("unix_socket_mode", "%#o is not a permission mode such as 0660", uint32(opts.UnixSocketMode))
+	}
+	if (opts.TLS.CertFile == "") != (opts.TLS.KeyFile == "") {
+		invalid("tls", "cert_file and key_file must be set together")
+	}
+	if err := opts.HTTP2.validate(); err != nil {
+		errs = append(errs, &ConfigError{Source: "validate", Err: err})
+	}
+	return errs
+}
+
+// Dump returns the configuration loaded by Load, one "key = value (source)" line per setting, where the
+// source is the file, environment variable or flag that set the value last, or "default". The values of
+// secret settings are redacted.
+func (l *ConfigLoader) Dump() string {
+	return strings.Join(l.dump(reflect.Value{}), "\n")
+}
+
+// dump formats the settings. When effective is a valid MyAPIServer value, the options are read from it
+// instead, showing the defaults applied by NewMyAPIServer.
+func (l *ConfigLoader) dump(effective reflect.Value) []string {
+	lines := make([]string, 0, len(l.fields))
+	for _, field := range l.fields {
+		value := field.value
+		if field.target == 0 && effective.IsValid() {
+			if v, ok := fieldByNames(effective, field.names); ok && v.Type() == value.Type() {
+				value = v
+			}
+		}
+		source, ok := l.sources[field.key]
+		if !ok {
+			source = "default"
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s (%s)", field.key, formatConfigValue(value, field.secret), source))
+	}
+	return lines
+}
+
+// fieldByNames follows the field names from the struct value.
+func fieldByNames(value reflect.Value, names []string) (reflect.Value, bool) {
+	for _, name := range names {
+		value = value.FieldByName(name)
+		if !value.IsValid() {
+			return value, false
+		}
+	}
+	return value, true
+}
+
+// formatConfigValue formats the value of a setting for Dump, redacting non-empty secrets.
+func formatConfigValue(value reflect.Value, secret bool) string {
+	if secret && !value.IsZero() {
+		return "<redacted>"
+	}
+	switch {
+	case value.Type() == fileModeType:
+		return fmt.Sprintf("%#o", value.Uint())
+	case value.Kind() == reflect.String:
+		return strconv.Quote(value.String())
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// logConfig logs the effective configuration when the options were loaded with a ConfigLoader.
+func (api *MyAPIServer) logConfig() {
+	if api.Config == nil {
+		return
+	}
+	for _, line := range api.Config.dump(reflect.ValueOf(api).Elem()) {
+		api.Logger.Printf("config %s", line)
+	}
+}
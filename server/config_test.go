@@ -0,0 +1,260 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a configuration file in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// testLoader returns a loader reading the environment from the map and the flags from args.
+func testLoader(env map[string]string, args []string, files ...string) *ConfigLoader {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return &ConfigLoader{
+		EnvPrefix: "APP",
+		Files:     files,
+		Args:      args,
+		FlagSet:   flags,
+		LookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+	}
+}
+
+// dumpLine returns the line of the dump for the key.
+func dumpLine(loader *ConfigLoader, key string) string {
+	for _, line := range strings.Split(loader.Dump(), "\n") {
+		if strings.HasPrefix(line, key+" = ") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestConfigLoaderPrecedence(t *testing.T) {
+	yamlFile := writeConfigFile(t, "base.yaml", "read_timeout: 2s\n")
+	jsonFile := writeConfigFile(t, "override.json", `{"readTimeout": "3s"}`)
+	tomlFile := writeConfigFile(t, "flag.toml", "read-timeout = \"4s\"\n")
+
+	tests := []struct {
+		name       string
+		files      []string
+		env        map[string]string
+		args       []string
+		want       time.Duration
+		wantSource string
+	}{
+		{name: "code", args: []string{}, want: time.Second, wantSource: "default"},
+		{name: "file", files: []string{yamlFile}, want: 2 * time.Second, wantSource: "file " + yamlFile},
+		{name: "later file", files: []string{yamlFile, jsonFile}, want: 3 * time.Second, wantSource: "file " + jsonFile},
+		{name: "config flag file", files: []string{yamlFile, jsonFile}, args: []string{"-config", tomlFile}, want: 4 * time.Second, wantSource: "file " + tomlFile},
+		{
+			name:       "env",
+			files:      []string{yamlFile},
+			args:       []string{"-config", tomlFile},
+			env:        map[string]string{"APP_READ_TIMEOUT": "5s"},
+			want:       5 * time.Second,
+			wantSource: "env APP_READ_TIMEOUT",
+		},
+		{
+			name:       "flag",
+			files:      []string{yamlFile},
+			env:        map[string]string{"APP_READ_TIMEOUT": "5s"},
+			args:       []string{"-read-timeout", "6s"},
+			want:       6 * time.Second,
+			wantSource: "flag -read-timeout",
+		},
+		{
+			name:       "last flag",
+			args:       []string{"-read-timeout=6s", "-read-timeout=7s"},
+			want:       7 * time.Second,
+			wantSource: "flag -read-timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := OptionalParams{ReadTimeout: time.Second}
+			loader := testLoader(tt.env, tt.args, tt.files...)
+			if err := loader.Load(&opts); err != nil {
+				t.Fatal(err)
+			}
+			if opts.ReadTimeout != tt.want {
+				t.Errorf("ReadTimeout = %v, want %v", opts.ReadTimeout, tt.want)
+			}
+			if line, want := dumpLine(loader, "read_timeout"), "read_timeout = "+tt.want.String()+" ("+tt.wantSource+")"; line != want {
+				t.Errorf("dump = %q, want %q", line, want)
+			}
+			if opts.Config != loader {
+				t.Error("Config not set to the loader")
+			}
+		})
+	}
+}
+
+// appConfig is an application struct loaded along with the options.
+type appConfig struct {
+	Database struct {
+		URL      string `config:"url" validate:"required"`
+		Password string `config:",secret"`
+		PoolSize int    `validate:"min=1"`
+	}
+	Features []string
+	Internal string `config:"-"`
+}
+
+func TestConfigLoaderParsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		file    string
+		content string
+		check   func(t *testing.T, opts *OptionalParams, app *appConfig)
+		wantErr error
+	}{
+		{
+			name: "env values",
+			env: map[string]string{
+				"APP_ADDR":              "127.0.0.1:9000",
+				"APP_ADDRS":             "127.0.0.1:9001, 127.0.0.1:9002",
+				"APP_UNIX_SOCKET_MODE":  "0660",
+				"APP_TLS_CERT_FILE":     "/tls/cert.pem",
+				"APP_TLS_KEY_FILE":      "/tls/key.pem",
+				"APP_H2C":               "true",
+				"APP_DATABASE_URL":      "postgres://db/app",
+				"APP_DATABASE_PASSWORD": "hunter2",
+				"APP_FEATURES":          "a,b",
+			},
+			check: func(t *testing.T, opts *OptionalParams, app *appConfig) {
+				if opts.Addr != "127.0.0.1:9000" || len(opts.Addrs) != 2 || opts.Addrs[1] != "127.0.0.1:9002" {
+					t.Errorf("Addr = %q, Addrs = %q", opts.Addr, opts.Addrs)
+				}
+				if opts.UnixSocketMode != 0o660 {
+					t.Errorf("UnixSocketMode = %#o, want 0660", opts.UnixSocketMode)
+				}
+				if opts.TLS.CertFile != "/tls/cert.pem" || opts.TLS.KeyFile != "/tls/key.pem" || !opts.H2C {
+					t.Errorf("TLS = %+v, H2C = %v", opts.TLS, opts.H2C)
+				}
+				if app.Database.URL != "postgres://db/app" || app.Database.Password != "hunter2" || strings.Join(app.Features, "|") != "a|b" {
+					t.Errorf("app = %+v", app)
+				}
+			},
+		},
+		{
+			name: "flag values",
+			args: []string{"-h2c", "-max-header-bytes", "4096", "-http2-max-concurrent-streams=50", "-web-socket-options-ping-interval", "1m", "-database-url", "postgres://db/app", "-features", "x"},
+			check: func(t *testing.T, opts *OptionalParams, app *appConfig) {
+				if !opts.H2C || opts.MaxHeaderBytes != 4096 || opts.HTTP2.MaxConcurrentStreams != 50 || opts.WebSocketOptions.PingInterval != time.Minute {
+					t.Errorf("options = H2C %v, MaxHeaderBytes %d, HTTP2 %+v, PingInterval %v", opts.H2C, opts.MaxHeaderBytes, opts.HTTP2, opts.WebSocketOptions.PingInterval)
+				}
+				if len(app.Features) != 1 || app.Features[0] != "x" {
+					t.Errorf("Features = %q", app.Features)
+				}
+			},
+		},
+		{
+			name:    "yaml sections and lists",
+			file:    "config.yaml",
+			content: "addrs: [\"127.0.0.1:1\", \"127.0.0.1:2\"]\nunix_socket_mode: 0660\ndatabase:\n  url: postgres://db/app\n  pool_size: 3\n",
+			check: func(t *testing.T, opts *OptionalParams, app *appConfig) {
+				if len(opts.Addrs) != 2 || app.Database.PoolSize != 3 || opts.UnixSocketMode != 0o660 {
+					t.Errorf("Addrs = %q, PoolSize = %d, UnixSocketMode = %#o", opts.Addrs, app.Database.PoolSize, opts.UnixSocketMode)
+				}
+			},
+		},
+		{
+			name:    "toml sections",
+			file:    "config.toml",
+			content: "drain_timeout = \"45s\"\n[database]\nurl = \"postgres://db/app\"\n",
+			check: func(t *testing.T, opts *OptionalParams, app *appConfig) {
+				if opts.DrainTimeout != 45*time.Second || app.Database.URL != "postgres://db/app" {
+					t.Errorf("DrainTimeout = %v, URL = %q", opts.DrainTimeout, app.Database.URL)
+				}
+			},
+		},
+		{
+			name:    "json large integer",
+			file:    "config.json",
+			content: `{"max_body_bytes": 9007199254740993, "database": {"url": "postgres://db/app"}}`,
+			check: func(t *testing.T, opts *OptionalParams, app *appConfig) {
+				if opts.MaxBodyBytes != 9007199254740993 {
+					t.Errorf("MaxBodyBytes = %d", opts.MaxBodyBytes)
+				}
+			},
+		},
+		{name: "invalid duration", env: map[string]string{"APP_READ_TIMEOUT": "soon"}, wantErr: ErrInvalidConfig},
+		{name: "invalid bool flag", args: []string{"-h2c=maybe"}, wantErr: ErrInvalidConfig},
+		{name: "negative timeout", args: []string{"-idle-timeout=-1s"}, wantErr: ErrInvalidConfig},
+		{name: "invalid address", env: map[string]string{"APP_ADDR": "localhost"}, wantErr: ErrInvalidConfig},
+		{name: "invalid socket mode", env: map[string]string{"APP_UNIX_SOCKET_MODE": "01777"}, wantErr: ErrInvalidConfig},
+		{name: "cert without key", env: map[string]string{"APP_TLS_CERT_FILE": "/tls/cert.pem"}, wantErr: ErrInvalidConfig},
+		{name: "validate tag", env: map[string]string{"APP_DATABASE_URL": ""}, wantErr: ErrInvalidConfig},
+		{name: "unknown file key", file: "config.yaml", content: "read_timout: 1s\n", wantErr: ErrUnknownConfigKey},
+		{name: "skipped field", file: "config.yaml", content: "internal: x\n", wantErr: ErrUnknownConfigKey},
+		{name: "unsupported format", file: "config.ini", content: "addr = :80\n", wantErr: ErrConfigFormat},
+		{name: "unknown flag", args: []string{"-no-such-flag"}, wantErr: errors.New("flag provided but not defined")},
+		{name: "help", args: []string{"-help"}, wantErr: flag.ErrHelp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			if tt.file != "" {
+				files = append(files, writeConfigFile(t, tt.file, tt.content))
+			}
+			opts := OptionalParams{}
+			app := appConfig{}
+			app.Database.URL = "postgres://localhost/app"
+			app.Database.PoolSize = 1
+			args := tt.args
+			if args == nil {
+				args = []string{}
+			}
+			err := testLoader(tt.env, args, files...).Load(&opts, &app)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Load: %v", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr) && (err == nil || !strings.Contains(err.Error(), tt.wantErr.Error())):
+				t.Fatalf("Load = %v, want %v", err, tt.wantErr)
+			case tt.check != nil:
+				tt.check(t, &opts, &app)
+			}
+		})
+	}
+}
+
+func TestConfigLoaderDumpRedactsSecrets(t *testing.T) {
+	opts := OptionalParams{}
+	app := appConfig{}
+	app.Database.URL = "postgres://localhost/app"
+	app.Database.PoolSize = 1
+	loader := testLoader(map[string]string{"APP_DATABASE_PASSWORD": "hunter2"}, nil)
+	if err := loader.Load(&opts, &app); err != nil {
+		t.Fatal(err)
+	}
+	dump := loader.Dump()
+	if strings.Contains(dump, "hunter2") {
+		t.Errorf("dump contains the password:\n%s", dump)
+	}
+	if line, want := dumpLine(loader, "database.password"), "database.password = <redacted> (env APP_DATABASE_PASSWORD)"; line != want {
+		t.Errorf("dump = %q, want %q", line, want)
+	}
+	if line := dumpLine(loader, "internal"); line != "" {
+		t.Errorf("skipped field dumped as %q", line)
+	}
+}
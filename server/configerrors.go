@@ -0,0 +1,179 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrNilHandler is reported when a route is registered with a nil handler function.
+	ErrNilHandler = errors.New("nil handler")
+
+	// ErrNilMiddleware is reported when a nil middleware function is added.
+	ErrNilMiddleware = errors.New("nil middleware")
+
+	// ErrInvalidMethod is reported when a route is registered with an invalid HTTP method.
+	ErrInvalidMethod = errors.New("invalid HTTP method")
+
+	// ErrNoMethods is reported when Match or MatchN is called with an empty method list.
+	ErrNoMethods = errors.New("no HTTP methods given")
+
+	// ErrInvalidPattern is reported when a route pattern cannot be parsed by the ServeMux.
+	ErrInvalidPattern = errors.New("invalid pattern")
+
+	// ErrPatternConflict is reported when a route pattern conflicts with an already registered one.
+	ErrPatternConflict = errors.New("conflicting pattern")
+
+	// ErrInvalidPrefix is reported when AddPrefix is called with a prefix not starting and ending with a slash.
+	ErrInvalidPrefix = errors.New("invalid prefix")
+)
+
+// ConfigError describes a single configuration problem found while setting up the server.
+type ConfigError struct {
+	// Source is the name of the function the problem was found in, e.g. "AddMiddleware".
+	Source string
+
+	// Method is the HTTP method of the route, if the problem concerns a route.
+	Method string
+
+	// Pattern is the URL pattern of the route, if the problem concerns a route.
+	Pattern string
+
+	// Err is the underlying error, usually one of the Err* variables of this package.
+	Err error
+}
+
+// Error returns a description of the configuration problem.
+func (e *ConfigError) Error() string {
+	if route := strings.TrimSpace(e.Method + " " + e.Pattern); route != "" {
+		return fmt.Sprintf("%s: %s: %v", e.Source, route, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Source, e.Err)
+}
+
+// Unwrap returns the underlying error so that errors.Is can be used on a ConfigError.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors is the list of configuration problems returned by Validate and Run.
+type ConfigErrors []*ConfigError
+
+// Error returns the configuration problems, one per line.
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d configuration error(s):\n%s", len(e), strings.Join(messages, "\n"))
+}
+
+// Unwrap returns the individual errors so that errors.Is and errors.As can be used on the list.
+func (e ConfigErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Validate returns the configuration problems collected while registering routes and middleware,
+// or nil if there are none. Problems are only collected when CollectConfigErrors is set;
+// otherwise the first problem ends the process as soon as it is found.
+// Validate also reports the OPTIONS handlers answering automatically that would conflict with each other
+// or with OPTIONS routes, such as those for GET /a/{x} and POST /{y}/b.
+func (api *MyAPIServer) Validate() error {
+	errs := append(ConfigErrors{}, api.configErrors...)
+	errs = append(errs, api.checkAutoOptions()...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// configError records a configuration problem, or logs it as fatal when errors are not collected.
+func (api *MyAPIServer) configError(err *ConfigError) {
+	if !api.CollectConfigErrors {
+		api.Logger.Fatalf("Invalid configuration: %v", err)
+		return
+	}
+	api.configErrors = append(api.configErrors, err)
+}
+
+// checkRoute reports whether the route can be registered, recording a configuration problem if not.
+func (api *MyAPIServer) checkRoute(method string, pattern string, handler http.Handler, middlewares []MiddlewareConvertedN) bool {
+	var err error
+	switch {
+	case !isToken(method):
+		err = ErrInvalidMethod
+	case pattern == "":
+		err = ErrInvalidPattern
+	case isNilHandler(handler):
+		err = ErrNilHandler
+	}
+	for _, middleware := range middlewares {
+		if err == nil && middleware == nil {
+			err = ErrNilMiddleware
+		}
+	}
+	if err != nil {
+		api.configError(&ConfigError{Source: "register", Method: method, Pattern: pattern, Err: err})
+		return false
+	}
+	return true
+}
+
+// handleMux registers the handler with the ServeMux, turning a registration panic into a configuration problem.
+func (api *MyAPIServer) handleMux(method string, pattern string, handler http.Handler) bool {
+	if err := handle(api.Serv.ServeMux, method, pattern, handler); err != nil {
+		api.configError(&ConfigError{Source: "register", Method: method, Pattern: pattern, Err: err})
+		return false
+	}
+	return true
+}
+
+// handle registers the handler with the mux, returning ErrPatternConflict or ErrInvalidPattern instead of panicking.
+func handle(mux *http.ServeMux, method string, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrInvalidPattern
+			if strings.Contains(fmt.Sprint(r), "conflicts with") || strings.Contains(fmt.Sprint(r), "multiple registrations") {
+				err = ErrPatternConflict
+			}
+			err = fmt.Errorf("%w: %v", err, r)
+		}
+	}()
+	mux.Handle(method+" "+pattern, handler)
+	return nil
+}
+
+// isNilHandler reports whether the handler is nil, including nil function values such as http.HandlerFunc(nil).
+func isNilHandler(handler http.Handler) bool {
+	if handler == nil {
+		return true
+	}
+	value := reflect.ValueOf(handler)
+	return value.Kind() == reflect.Func && value.IsNil()
+}
+
+// isToken reports whether s is a valid HTTP method token as defined by RFC 9110.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
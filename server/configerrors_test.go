@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestConfigErrors(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	handlerN := func(ctx ContextHandler) {}
+
+	tests := []struct {
+		name        string
+		register    func(api *MyAPIServer)
+		wantErrs    []error
+		wantSources []string
+	}{
+		{
+			name:     "valid",
+			register: func(api *MyAPIServer) { api.Get("/a", handler); api.PostN("/a", handlerN) },
+		},
+		{
+			name:        "nil handler",
+			register:    func(api *MyAPIServer) { api.Get("/a", nil); api.GetN("/b", nil) },
+			wantErrs:    []error{ErrNilHandler, ErrNilHandler},
+			wantSources: []string{"register", "register"},
+		},
+		{
+			name:        "nil middleware",
+			register:    func(api *MyAPIServer) { api.AddMiddleware(nil); api.AddMiddlewareN(nil); api.Get("/a", handler, nil) },
+			wantErrs:    []error{ErrNilMiddleware, ErrNilMiddleware, ErrNilMiddleware},
+			wantSources: []string{"AddMiddleware", "AddMiddlewareN", "register"},
+		},
+		{
+			name:        "invalid method",
+			register:    func(api *MyAPIServer) { api.Match([]string{"GE T"}, "/a", handler); api.MatchN(nil, "/a", handlerN) },
+			wantErrs:    []error{ErrInvalidMethod, ErrNoMethods},
+			wantSources: []string{"register", "MatchN"},
+		},
+		{
+			name:        "invalid pattern",
+			register:    func(api *MyAPIServer) { api.Get("/a/{", handler); api.Get("", handler) },
+			wantErrs:    []error{ErrInvalidPattern, ErrInvalidPattern},
+			wantSources: []string{"register", "register"},
+		},
+		{
+			name: "conflicting patterns",
+			register: func(api *MyAPIServer) {
+				api.Get("/users/{id}", handler)
+				api.GetN("/users/{name}", handlerN)
+				api.Get("/a/{x}", handler)
+				api.Get("/{y}/b", handler)
+			},
+			wantErrs:    []error{ErrPatternConflict, ErrPatternConflict},
+			wantSources: []string{"register", "register"},
+		},
+		{
+			name:        "invalid prefix",
+			register:    func(api *MyAPIServer) { api.AddPrefix("api") },
+			wantErrs:    []error{ErrInvalidPrefix},
+			wantSources: []string{"AddPrefix"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			tt.register(api)
+
+			err := api.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			var errs ConfigErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Validate = %v, want ConfigErrors", err)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("Validate returned %d errors, want %d:\n%v", len(errs), len(tt.wantErrs), err)
+			}
+			for i, want := range tt.wantErrs {
+				if !errors.Is(errs[i], want) || errs[i].Source != tt.wantSources[i] {
+					t.Errorf("error %d = %s %v, want %s %v", i, errs[i].Source, errs[i], tt.wantSources[i], want)
+				}
+				if !errors.Is(err, want) {
+					t.Errorf("errors.Is(list, %v) = false", want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigErrorsKeepValidRoutes(t *testing.T) {
+	api := newTestServer(t, nil)
+	api.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	api.Get("/users/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	api.Get("/broken", nil)
+
+	routes := api.Routes()
+	if len(routes) != 1 || routes[0].Pattern != "/users/{id}" {
+		t.Errorf("Routes = %v, want only GET /users/{id}", routes)
+	}
+}
+
+func TestStartReturnsConfigErrors(t *testing.T) {
+	for _, run := range []struct {
+		name  string
+		start func(api *MyAPIServer) error
+	}{
+		{"Start", (*MyAPIServer).Start},
+		{"Run", (*MyAPIServer).Run},
+	} {
+		t.Run(run.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.Get("/a", nil)
+			api.AddMiddleware(nil)
+
+			err := run.start(api)
+			var errs ConfigErrors
+			if !errors.As(err, &errs) || len(errs) != 2 {
+				t.Fatalf("%s = %v, want the 2 configuration errors", run.name, err)
+			}
+			if err := api.Stop(context.Background()); !errors.Is(err, ErrServerNotStarted) {
+				t.Errorf("Stop = %v, want ErrServerNotStarted", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// handlerChain holds the ordered ContextHandler functions executed for a single request
+// together with the position of the function currently running.
+type handlerChain struct {
+	// handlers is the ordered list of functions executed for the request.
+	handlers []func(ContextHandler)
+
+	// index is the position of the function currently being executed.
+	index int
+
+	// aborted reports whether Abort has been called on the chain.
+	aborted bool
+}
+
+// newHandlerChain creates a handler chain that starts before the first handler.
+func newHandlerChain(handlers ...func(ContextHandler)) *handlerChain {
+	return &handlerChain{handlers: handlers, index: -1}
+}
+
+// Next executes the remaining handlers in the chain.
+// It should only be called from inside a middleware; code placed after Next runs once the
+// downstream handlers have returned, which allows a middleware to inspect the response.
+// If a middleware returns without calling Next and without calling Abort, the remaining
+// handlers are executed automatically once it returns.
+func (ctx *ContextHandler) Next() {
+	if ctx.chain == nil {
+		return
+	}
+	ctx.chain.index++
+	for ctx.chain.index < len(ctx.chain.handlers) {
+		ctx.chain.handlers[ctx.chain.index](*ctx)
+		ctx.chain.index++
+	}
+}
+
+// Abort prevents the remaining handlers in the chain from being executed.
+// It does not stop the current handler; return after calling Abort to do so.
+func (ctx *ContextHandler) Abort() {
+	if ctx.chain == nil {
+		return
+	}
+	ctx.chain.aborted = true
+	ctx.chain.index = len(ctx.chain.handlers)
+}
+
+// AbortWithStatus writes the status code to the response and prevents the remaining
+// handlers in the chain from being executed.
+func (ctx *ContextHandler) AbortWithStatus(code int) {
+	ctx.Writer.WriteHeader(code)
+	ctx.Abort()
+}
+
+// IsAborted reports whether the current chain has been aborted.
+func (ctx *ContextHandler) IsAborted() bool {
+	return ctx.chain != nil && ctx.chain.aborted
+}
+
+// writePendingStatus sends the status set with Status if nothing has been written by the handlers.
+func (ctx *ContextHandler) writePendingStatus() {
+	if rw, ok := ctx.Writer.(*responseWriter); ok && rw.status == 0 && rw.pending != 0 {
+		rw.WriteHeader(rw.pending)
+	}
+}
+
+// Response returns the ResponseWriter used by the context, which reports the status code
+// written so far. It is typically used by middleware after calling Next.
+func (ctx *ContextHandler) Response() ResponseWriter {
+	if rw, ok := ctx.Writer.(ResponseWriter); ok {
+		return rw
+	}
+	return wrapResponseWriter(ctx.Writer)
+}
+
+// ResponseWriter extends http.ResponseWriter with details about the response written so far.
+type ResponseWriter interface {
+	http.ResponseWriter
+
+	// Status returns the HTTP status code of the response, or 0 if nothing has been written yet.
+	Status() int
+
+	// Written reports whether the response headers have already been sent to the client.
+	Written() bool
+
+	// Size returns the number of bytes of body written so far.
+	Size() int
+}
+
+// responseWriter is the default ResponseWriter implementation wrapping an http.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
+
+	// status is the status code sent to the client.
+	status int
+
+	// pending is the status code set with ContextHandler.Status, sent with the first write.
+	pending int
+
+	// size is the number of bytes of body written so far.
+	size int
+}
+
+// wrapResponseWriter wraps w into a ResponseWriter unless it already is one.
+func wrapResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and sends the response headers.
+// Subsequent calls are ignored, matching the behaviour of net/http. Informational responses other than
+// 101 Switching Protocols, such as 103 Early Hints, are sent without being recorded, as they precede
+// the final response.
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status != 0 {
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the connection, sending the pending status, or 200, first if none was written.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.writePending()
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// writePending sends the pending status, or 200 if none was set.
+func (rw *responseWriter) writePending() {
+	if rw.pending != 0 {
+		rw.WriteHeader(rw.pending)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// Status returns the HTTP status code of the response, or 0 if nothing has been written yet.
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+// Written reports whether the response headers have already been sent to the client.
+func (rw *responseWriter) Written() bool {
+	return rw.status != 0
+}
+
+// Size returns the number of bytes of body written so far.
+func (rw *responseWriter) Size() int {
+	return rw.size
+}
+
+// Flush sends any buffered data to the client if the underlying writer supports it, and does nothing otherwise.
+func (rw *responseWriter) Flush() {
+	rw.FlushError()
+}
+
+// FlushError flushes like Flush, returning http.ErrNotSupported when the underlying writer cannot flush.
+// http.ResponseController uses it to report whether streaming is possible.
+// The response headers are only sent when the writer can flush.
+func (rw *responseWriter) FlushError() error {
+	if !canFlush(rw.ResponseWriter) {
+		return http.ErrNotSupported
+	}
+	if rw.status == 0 {
+		rw.writePending()
+	}
+	return http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// canFlush reports whether the writer, or one it wraps, can flush, as looked up by http.ResponseController.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch writer := w.(type) {
+		case interface{ FlushError() error }, http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// Hijack lets the caller take over the connection if the underlying writer supports it.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, as used by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
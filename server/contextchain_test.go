@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterInformational(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    func(ctx ContextHandler)
+		wantHints  []int
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "early hints then body",
+			handler: func(ctx ContextHandler) {
+				ctx.Writer.Header().Set("Link", "</style.css>; rel=preload; as=style")
+				ctx.Writer.WriteHeader(http.StatusEarlyHints)
+				if ctx.Response().Written() {
+					t.Error("Written after 103 Early Hints")
+				}
+				ctx.Writer.Write([]byte("page"))
+			},
+			wantHints:  []int{http.StatusEarlyHints},
+			wantStatus: http.StatusOK,
+			wantBody:   "page",
+		},
+		{
+			name: "early hints then pending status",
+			handler: func(ctx ContextHandler) {
+				ctx.Writer.WriteHeader(http.StatusEarlyHints)
+				ctx.Status(http.StatusCreated)
+				ctx.Writer.Write([]byte("created"))
+			},
+			wantHints:  []int{http.StatusEarlyHints},
+			wantStatus: http.StatusCreated,
+			wantBody:   "created",
+		},
+		{
+			name: "status after early hints",
+			handler: func(ctx ContextHandler) {
+				ctx.Writer.WriteHeader(http.StatusEarlyHints)
+				ctx.Writer.WriteHeader(http.StatusAccepted)
+				ctx.Writer.WriteHeader(http.StatusTeapot)
+				if got := ctx.Response().Status(); got != http.StatusAccepted {
+					t.Errorf("Status = %d, want 202", got)
+				}
+			},
+			wantHints:  []int{http.StatusEarlyHints},
+			wantStatus: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.GetN("/page", tt.handler)
+			server := httptest.NewServer(api.ServMConfigure(nil))
+			defer server.Close()
+
+			var hints []int
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+					hints = append(hints, code)
+					return nil
+				},
+			}
+			req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL+"/page", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if len(hints) != len(tt.wantHints) || (len(hints) > 0 && hints[0] != tt.wantHints[0]) {
+				t.Errorf("informational responses = %v, want %v", hints, tt.wantHints)
+			}
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+// plainWriter is a ResponseWriter that cannot flush.
+type plainWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *plainWriter) Header() http.Header         { return w.header }
+func (w *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainWriter) WriteHeader(code int)        { w.status = code }
+
+// unwrappingWriter wraps a ResponseWriter without flushing itself, like many middleware writers.
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrappingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func TestResponseWriterFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		writer      func() (http.ResponseWriter, func() int)
+		wantErr     error
+		wantWritten bool
+	}{
+		{
+			name: "flusher",
+			writer: func() (http.ResponseWriter, func() int) {
+				w := httptest.NewRecorder()
+				return w, func() int { return w.Code }
+			},
+			wantWritten: true,
+		},
+		{
+			name: "wrapped flusher",
+			writer: func() (http.ResponseWriter, func() int) {
+				w := httptest.NewRecorder()
+				return unwrappingWriter{w}, func() int { return w.Code }
+			},
+			wantWritten: true,
+		},
+		{
+			name: "no flusher",
+			writer: func() (http.ResponseWriter, func() int) {
+				w := &plainWriter{header: http.Header{}}
+				return w, func() int { return w.status }
+			},
+			wantErr: http.ErrNotSupported,
+		},
+		{
+			name: "wrapped writer without flusher",
+			writer: func() (http.ResponseWriter, func() int) {
+				w := &plainWriter{header: http.Header{}}
+				return unwrappingWriter{w}, func() int { return w.status }
+			},
+			wantErr: http.ErrNotSupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, status := tt.writer()
+			rw := &responseWriter{ResponseWriter: w, pending: http.StatusAccepted}
+			rw.Flush()
+			if err := rw.FlushError(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("FlushError = %v, want %v", err, tt.wantErr)
+			}
+			if rw.Written() != tt.wantWritten {
+				t.Errorf("Written = %v, want %v", rw.Written(), tt.wantWritten)
+			}
+			wantStatus := 0
+			if tt.wantWritten {
+				wantStatus = http.StatusAccepted
+			}
+			if got := status(); got != wantStatus {
+				t.Errorf("status sent = %d, want %d", got, wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNextAndAbort(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware func(ctx ContextHandler, order *[]string)
+		wantOrder  string
+		wantStatus int
+	}{
+		{
+			name:       "neither Next nor Abort",
+			middleware: func(ctx ContextHandler, order *[]string) { *order = append(*order, "middleware") },
+			wantOrder:  "middleware, handler",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Next",
+			middleware: func(ctx ContextHandler, order *[]string) {
+				*order = append(*order, "before")
+				ctx.Next()
+				*order = append(*order, "after "+http.StatusText(ctx.Response().Status()))
+			},
+			wantOrder:  "before, handler, after Created",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "AbortWithStatus",
+			middleware: func(ctx ContextHandler, order *[]string) {
+				*order = append(*order, "middleware")
+				ctx.AbortWithStatus(http.StatusUnauthorized)
+				if !ctx.IsAborted() {
+					t.Error("IsAborted false after AbortWithStatus")
+				}
+			},
+			wantOrder:  "middleware",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Abort after writing",
+			middleware: func(ctx ContextHandler, order *[]string) {
+				*order = append(*order, "middleware")
+				ctx.JSONStatus(http.StatusTooManyRequests, map[string]string{"error": "slow down"})
+				ctx.Abort()
+			},
+			wantOrder:  "middleware",
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "Abort after Next",
+			middleware: func(ctx ContextHandler, order *[]string) {
+				ctx.Next()
+				ctx.Abort()
+				*order = append(*order, "after")
+			},
+			wantOrder:  "handler, after",
+			wantStatus: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		for _, scope := range []string{"server", "route"} {
+			t.Run(tt.name+" in "+scope+" middleware", func(t *testing.T) {
+				var order []string
+				middleware := func(ctx ContextHandler) { tt.middleware(ctx, &order) }
+				handler := func(ctx ContextHandler) {
+					order = append(order, "handler")
+					ctx.Writer.WriteHeader(http.StatusCreated)
+				}
+				api := newTestServer(t, nil)
+				if scope == "server" {
+					api.AddMiddlewareN(middleware)
+					api.GetN("/test", handler)
+				} else {
+					api.GetN("/test", handler, middleware)
+				}
+
+				w := httptest.NewRecorder()
+				api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				if got := strings.Join(order, ", "); got != tt.wantOrder {
+					t.Errorf("order = %s, want %s", got, tt.wantOrder)
+				}
+			})
+		}
+	}
+}
@@ -8,43 +8,210 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
 )
 
 // JSON writes a JSON response with the provided data to the ResponseWriter.
 // It sets the Content-Type header to application/json.
-// If an error occurs during JSON marshalling, it writes an error response with status code 500.
+// The output follows the JSONOptions of the server and is indented when the request has ?pretty=true.
+// When JSONOptions.JSONP is set and the request has a callback parameter, it answers with JSONP instead.
+// If an error occurs during JSON marshalling, it writes an error response with status code 500
+// through the error renderer of the server.
 func (ctx *ContextHandler) JSON(data interface{}) {
-	// Set Content-Type header to application/json
-	ctx.Writer.Header().Set("Content-Type", "application/json")
+	if ctx.jsonOptions().JSONP && ctx.jsonpCallback() != "" {
+		ctx.JSONP(data)
+		return
+	}
 
 	// Marshal the data to JSON
-	jsonBytes, err := json.Marshal(data)
+	jsonBytes, err := ctx.marshalJSON(data)
 	if err != nil {
 		// If an error occurs during JSON marshalling, write an error response
-		ctx.Writer.WriteHeader(http.StatusInternalServerError)
-		ctx.Writer.Write([]byte(`{"error": "Internal Server Error"}`))
+		ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: err})
 		return
 	}
 
+	// Set Content-Type header to application/json
+	ctx.Writer.Header().Set("Content-Type", "application/json")
+
 	// Write the JSON response
 	ctx.Writer.Write(jsonBytes)
 }
 
+// JSONP writes the data as a JavaScript call to the callback named by the callback query parameter,
+// with the Content-Type application/javascript. Callback names must be JavaScript identifiers,
+// optionally separated by dots; any other name is answered with 400 Bad Request.
+// Without a callback parameter, it writes a plain JSON response.
+func (ctx *ContextHandler) JSONP(data interface{}) {
+	callback := ctx.jsonpCallback()
+	if callback == "" {
+		jsonBytes, err := ctx.marshalJSON(data)
+		if err != nil {
+			ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: err})
+			return
+		}
+		ctx.Writer.Header().Set("Content-Type", "application/json")
+		ctx.Writer.Write(jsonBytes)
+		return
+	}
+	if !IsValidJSONPCallback(callback) {
+		ctx.Error(NewHTTPError(http.StatusBadRequest, "invalid JSONP callback name"))
+		return
+	}
+
+	jsonBytes, err := ctx.marshalJSON(data)
+	if err != nil {
+		ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: err})
+		return
+	}
+
+	// The leading comment prevents the response from being interpreted as another content type
+	ctx.Writer.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	ctx.Writer.Header().Set("X-Content-Type-Options", "nosniff")
+	ctx.Writer.Write([]byte("/**/" + callback + "("))
+	ctx.Writer.Write(jsonBytes)
+	ctx.Writer.Write([]byte(");"))
+}
+
 // DecodeJSON reads the JSON data from the request body and decodes it into the provided interface.
-// It returns an error if reading or unmarshalling the JSON data fails.
+// The body is limited to the size configured with MaxBodyBytes or BodyLimit, unknown fields are rejected
+// when StrictJSON is set, and the body must contain exactly one JSON value.
+// It returns a *BodyError wrapping ErrBodyTooLarge, ErrEmptyBody, ErrSyntax, ErrFieldType,
+// ErrUnknownField or ErrTrailingData if the body cannot be decoded.
 func (ctx *ContextHandler) DecodeJSON(v interface{}) error {
-	// Read the request body
-	body, err := io.ReadAll(ctx.Request.Body)
+	return ctx.decodeJSON(v, ctx.api != nil && ctx.api.StrictJSON)
+}
+
+// DecodeJSONStrict behaves like DecodeJSON but always rejects unknown fields.
+func (ctx *ContextHandler) DecodeJSONStrict(v interface{}) error {
+	return ctx.decodeJSON(v, true)
+}
+
+// DecodeJSONArray decodes a request body holding a JSON array one element at a time, so that large
+// arrays don't have to be held in memory. The function is called once per element and must decode
+// exactly one value from the decoder, e.g. with dec.Decode(&item). Returning an error stops the decoding,
+// as does returning without reading from the decoder, which is reported as an ErrSyntax *BodyError.
+func (ctx *ContextHandler) DecodeJSONArray(fn func(dec *json.Decoder) error) error {
+	defer ctx.Request.Body.Close()
+	dec := ctx.jsonDecoder(ctx.api != nil && ctx.api.StrictJSON)
+
+	// Read the opening bracket
+	token, err := dec.Token()
 	if err != nil {
-		return err
+		return ctx.bodyError(dec, err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return &BodyError{Kind: ErrSyntax, Offset: dec.InputOffset(), Err: errors.New("expected a JSON array")}
+	}
+
+	// Decode each element
+	for dec.More() {
+		offset := dec.InputOffset()
+		if err = fn(dec); err != nil {
+			return ctx.bodyError(dec, err)
+		}
+		// Calling fn again would see the same element forever
+		if dec.InputOffset() == offset {
+			return &BodyError{Kind: ErrSyntax, Offset: offset, Err: errors.New("array element not decoded")}
+		}
+	}
+
+	// Read the closing bracket and make sure nothing follows
+	if _, err = dec.Token(); err != nil {
+		return ctx.bodyError(dec, err)
 	}
+	return ctx.checkTrailingData(dec)
+}
+
+// decodeJSON decodes the request body into v, optionally rejecting unknown fields.
+func (ctx *ContextHandler) decodeJSON(v interface{}, strict bool) error {
 	defer ctx.Request.Body.Close()
+	dec := ctx.jsonDecoder(strict)
+
+	// Decode the JSON value into the provided interface
+	if err := dec.Decode(v); err != nil {
+		return ctx.bodyError(dec, err)
+	}
+	return ctx.checkTrailingData(dec)
+}
+
+// jsonDecoder returns a decoder reading the size limited request body.
+func (ctx *ContextHandler) jsonDecoder(strict bool) *json.Decoder {
+	ctx.limitBody()
+	dec := json.NewDecoder(ctx.Request.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec
+}
+
+// checkTrailingData returns an error if the body contains anything but whitespace after the decoded JSON value,
+// whether it is another value or not valid JSON at all, such as the x of {"a":5}x.
+func (ctx *ContextHandler) checkTrailingData(dec *json.Decoder) error {
+	rest := io.MultiReader(dec.Buffered(), ctx.Request.Body)
+	offset := dec.InputOffset()
+	buf := make([]byte, 512)
+	for {
+		n, err := rest.Read(buf)
+		for _, c := range buf[:n] {
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				return &BodyError{Kind: ErrTrailingData, Offset: offset}
+			}
+			offset++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ctx.bodyError(dec, err)
+		}
+	}
+}
+
+// limitBody limits the request body to the size configured for the server,
+// unless a limit has already been applied by BodyLimit or a previous call.
+func (ctx *ContextHandler) limitBody() {
+	if ctx.Request.Context().Value(bodyLimitKey) != nil {
+		return
+	}
+	limit := DefaultMaxBodyBytes
+	if ctx.api != nil {
+		limit = ctx.api.MaxBodyBytes
+	}
+	ctx.Request = limitRequestBody(ctx.Writer, ctx.Request, limit)
+}
 
-	// Unmarshal the JSON data into the provided interface
-	if err = json.Unmarshal(body, &v); err != nil {
-		return err
+// bodyError converts an error returned while reading or decoding the body into a *BodyError.
+// The decoder is nil for errors returned while parsing a form.
+func (ctx *ContextHandler) bodyError(dec *json.Decoder, err error) error {
+	var (
+		maxBytesErr  *http.MaxBytesError
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		bodyErr      *BodyError
+		unknownField string
+	)
+	unknownField, _ = strings.CutPrefix(err.Error(), "json: unknown field ")
+	switch {
+	case errors.As(err, &bodyErr):
+		return bodyErr
+	case errors.As(err, &maxBytesErr):
+		return &BodyError{Kind: ErrBodyTooLarge, Limit: maxBytesErr.Limit, Err: err}
+	case dec == nil:
+		return &BodyError{Kind: ErrSyntax, Err: err}
+	case errors.Is(err, io.EOF):
+		return &BodyError{Kind: ErrEmptyBody, Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &BodyError{Kind: ErrSyntax, Offset: dec.InputOffset(), Err: err}
+	case errors.As(err, &syntaxErr):
+		return &BodyError{Kind: ErrSyntax, Offset: syntaxErr.Offset, Err: err}
+	case errors.As(err, &typeErr):
+		return &BodyError{Kind: ErrFieldType, Offset: typeErr.Offset, Field: typeErr.Field, Err: err}
+	case unknownField != err.Error():
+		return &BodyError{Kind: ErrUnknownField, Offset: dec.InputOffset(), Field: strings.Trim(unknownField, `"`), Err: err}
 	}
-	return nil
+	return err
 }
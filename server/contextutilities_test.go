@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		strict     bool
+		maxBytes   int64
+		wantErr    error
+		wantOffset int64
+	}{
+		{name: "valid", body: `{"a":5}`},
+		{name: "trailing whitespace", body: "{\"a\":5} \r\n\t"},
+		{name: "empty", body: "", wantErr: ErrEmptyBody},
+		{name: "syntax", body: `{"a":}`, wantErr: ErrSyntax},
+		{name: "truncated", body: `{"a":5`, wantErr: ErrSyntax},
+		{name: "field type", body: `{"a":"five"}`, wantErr: ErrFieldType},
+		{name: "unknown field", body: `{"a":5,"b":6}`, strict: true, wantErr: ErrUnknownField},
+		{name: "second value", body: `{"a":5} {"a":6}`, wantErr: ErrTrailingData, wantOffset: 8},
+		{name: "trailing garbage", body: `{"a":5}x`, wantErr: ErrTrailingData, wantOffset: 7},
+		{name: "trailing brace", body: `{"a":5}}`, wantErr: ErrTrailingData, wantOffset: 7},
+		{name: "garbage after whitespace", body: "{\"a\":5}\n\n]", wantErr: ErrTrailingData, wantOffset: 9},
+		{name: "too large", body: `{"a":5}` + strings.Repeat(" ", 100), maxBytes: 32, wantErr: ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, &OptionalParams{StrictJSON: tt.strict, MaxBodyBytes: tt.maxBytes})
+			var err error
+			api.PostN("/decode", func(ctx ContextHandler) {
+				var v struct {
+					A int `json:"a"`
+				}
+				err = ctx.DecodeJSON(&v)
+			})
+			api.ServMConfigure(nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/decode", strings.NewReader(tt.body)))
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeJSON(%q) = %v, want %v", tt.body, err, tt.wantErr)
+			}
+			var bodyErr *BodyError
+			if tt.wantErr == ErrTrailingData && errors.As(err, &bodyErr) && bodyErr.Offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", bodyErr.Offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		skip    bool
+		want    int
+		wantErr error
+	}{
+		{name: "valid", body: `[1, 2, 3]`, want: 6},
+		{name: "empty", body: ` [ ] `, want: 0},
+		{name: "element not decoded", body: `[1, 2]`, skip: true, wantErr: ErrSyntax},
+		{name: "not an array", body: `{"a":1}`, wantErr: ErrSyntax},
+		{name: "bad element", body: `[1, "two"]`, wantErr: ErrFieldType},
+		{name: "trailing garbage", body: `[1, 2]x`, wantErr: ErrTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			var (
+				sum int
+				err error
+			)
+			api.PostN("/decode", func(ctx ContextHandler) {
+				err = ctx.DecodeJSONArray(func(dec *json.Decoder) error {
+					if tt.skip {
+						return nil
+					}
+					var n int
+					if err := dec.Decode(&n); err != nil {
+						return err
+					}
+					sum += n
+					return nil
+				})
+			})
+			api.ServMConfigure(nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/decode", strings.NewReader(tt.body)))
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeJSONArray(%q) = %v, want %v", tt.body, err, tt.wantErr)
+			}
+			if err == nil && sum != tt.want {
+				t.Errorf("sum = %d, want %d", sum, tt.want)
+			}
+		})
+	}
+}
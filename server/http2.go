@@ -0,0 +1,139 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// DefaultReadHeaderTimeout is the maximum duration for reading the request headers, protecting the
+// server from clients sending them slowly (Slowloris).
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// ErrInvalidHTTP2 is reported when the HTTP/2 options cannot be used.
+var ErrInvalidHTTP2 = errors.New("invalid HTTP/2 configuration")
+
+// HTTP2Options tunes HTTP/2, served over TLS and, with H2C, over cleartext connections.
+// Zero values keep the defaults of golang.org/x/net/http2.
+type HTTP2Options struct {
+	// MaxConcurrentStreams is the number of concurrent streams a client may open per connection (250 when 0).
+	MaxConcurrentStreams uint32
+
+	// MaxReadFrameSize is the largest frame the server accepts, between 16KB and 16MB (1MB when 0).
+	MaxReadFrameSize uint32
+
+	// MaxDecoderHeaderTableSize and MaxEncoderHeaderTableSize limit the HPACK tables compressing headers (4KB when 0).
+	MaxDecoderHeaderTableSize uint32
+	MaxEncoderHeaderTableSize uint32
+
+	// MaxUploadBufferPerConnection and MaxUploadBufferPerStream are the flow control windows for request bodies,
+	// per connection and per stream (1MB when 0).
+	MaxUploadBufferPerConnection int32
+	MaxUploadBufferPerStream     int32
+
+	// ReadIdleTimeout is how long a connection may go without receiving frames before a ping checks it is alive.
+	// Health checks are disabled when 0.
+	ReadIdleTimeout time.Duration
+
+	// PingTimeout is how long to wait for the answer to such a ping before closing the connection (15s when 0).
+	PingTimeout time.Duration
+
+	// WriteByteTimeout closes the connection when no data can be written to it for this long. Disabled when 0.
+	WriteByteTimeout time.Duration
+}
+
+// enabled reports whether any option differs from the defaults.
+func (options HTTP2Options) enabled() bool {
+	return options != HTTP2Options{}
+}
+
+// validate checks the options against the limits of the HTTP/2 specification.
+func (options HTTP2Options) validate() error {
+	if options.MaxReadFrameSize != 0 && (options.MaxReadFrameSize < 1<<14 || options.MaxReadFrameSize > 1<<24-1) {
+		return fmt.Errorf("%w: MaxReadFrameSize %d out of range [16384, 16777215]", ErrInvalidHTTP2, options.MaxReadFrameSize)
+	}
+	if options.MaxUploadBufferPerConnection < 0 || options.MaxUploadBufferPerStream < 0 {
+		return fmt.Errorf("%w: negative upload buffer", ErrInvalidHTTP2)
+	}
+	if options.MaxUploadBufferPerConnection != 0 && options.MaxUploadBufferPerConnection < 1<<16-1 {
+		return fmt.Errorf("%w: MaxUploadBufferPerConnection %d below the 65535 bytes initial window", ErrInvalidHTTP2, options.MaxUploadBufferPerConnection)
+	}
+	return nil
+}
+
+// server returns the HTTP/2 server configured with the options.
+func (options HTTP2Options) server() *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams:         options.MaxConcurrentStreams,
+		MaxReadFrameSize:             options.MaxReadFrameSize,
+		MaxDecoderHeaderTableSize:    options.MaxDecoderHeaderTableSize,
+		MaxEncoderHeaderTableSize:    options.MaxEncoderHeaderTableSize,
+		MaxUploadBufferPerConnection: options.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     options.MaxUploadBufferPerStream,
+		ReadIdleTimeout:              options.ReadIdleTimeout,
+		PingTimeout:                  options.PingTimeout,
+		WriteByteTimeout:             options.WriteByteTimeout,
+	}
+}
+
+// ConnStateHook is called when a client connection changes state, like http.Server.ConnState,
+// e.g. to count open connections or log idle ones.
+type ConnStateHook func(conn net.Conn, state http.ConnState)
+
+// OnConnState adds a hook called whenever a client connection changes state. Hooks run in the order they
+// were added, after the ConnState option, on the goroutine serving the connection, so they must be fast.
+// Connections served over HTTP/2 with H2C report http.StateHijacked once upgraded.
+func (api *MyAPIServer) OnConnState(hook ConnStateHook) {
+	if hook == nil {
+		api.configError(&ConfigError{Source: "OnConnState", Err: ErrNilHandler})
+		return
+	}
+	api.connStateHooks = append(api.connStateHooks, hook)
+}
+
+// connState tracks the connections waiting for their first request, for graceful restarts,
+// and calls the connection state hooks.
+func (api *MyAPIServer) connState() func(net.Conn, http.ConnState) {
+	return func(conn net.Conn, state http.ConnState) {
+		api.pendingConns.track(conn, state)
+		if api.ConnState != nil {
+			api.ConnState(conn, state)
+		}
+		for _, hook := range api.connStateHooks {
+			hook(conn, state)
+		}
+	}
+}
+
+// configureHTTP2 applies the HTTP/2 options to the server, and serves cleartext HTTP/2 when H2C is set.
+// Without options, the HTTP/2 support of net/http is left in place.
+func (api *MyAPIServer) configureHTTP2(prodServer *http.Server) {
+	cleartext := api.H2C && api.tlsConfig == nil
+	if !cleartext && !api.HTTP2.enabled() {
+		return
+	}
+	h2s := api.HTTP2.server()
+	if err := http2.ConfigureServer(prodServer, h2s); err != nil {
+		api.Logger.Printf("Error configuring HTTP/2: %v", err)
+		return
+	}
+	if api.tlsConfig == nil {
+		// ConfigureServer prepares a TLS configuration, the server still serves plain HTTP
+		prodServer.TLSConfig = nil
+	}
+	if cleartext {
+		// Serves both clients upgrading with "Upgrade: h2c" and clients starting with the HTTP/2 preface
+		prodServer.Handler = h2c.NewHandler(prodServer.Handler, h2s)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// testCertificate returns the self-signed certificate of net/http/httptest.
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	defer server.Close()
+	return server.TLS.Certificates[0]
+}
+
+func TestHTTP2(t *testing.T) {
+	certificate := testCertificate(t)
+	tests := []struct {
+		name      string
+		tls       bool
+		h2c       bool
+		http2     HTTP2Options
+		transport func() http.RoundTripper
+		wantProto string
+	}{
+		{
+			name:      "TLS with default HTTP/2",
+			tls:       true,
+			transport: tlsTransport,
+			wantProto: "HTTP/2.0",
+		},
+		{
+			name:      "TLS with HTTP/2 options",
+			tls:       true,
+			http2:     HTTP2Options{MaxConcurrentStreams: 10},
+			transport: tlsTransport,
+			wantProto: "HTTP/2.0",
+		},
+		{
+			name:      "h2c with prior knowledge",
+			h2c:       true,
+			transport: h2cTransport,
+			wantProto: "HTTP/2.0",
+		},
+		{
+			name:      "h2c server with HTTP/1.1 client",
+			h2c:       true,
+			transport: func() http.RoundTripper { return &http.Transport{} },
+			wantProto: "HTTP/1.1",
+		},
+		{
+			name:      "plain HTTP",
+			transport: func() http.RoundTripper { return &http.Transport{} },
+			wantProto: "HTTP/1.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &OptionalParams{H2C: tt.h2c, HTTP2: tt.http2}
+			if tt.tls {
+				opts.TLS = TLSOptions{Config: &tls.Config{Certificates: []tls.Certificate{certificate}}}
+			}
+			api := newTestServer(t, opts)
+			api.Get("/proto", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.Proto)) })
+
+			// Configuring the server repeatedly, as restarts do, leaves the TLS configuration of the options alone
+			for i := 0; i < 2; i++ {
+				prodServer := api.ConfigureServer(api.ServMConfigure(nil))
+				if tt.tls && prodServer.TLSConfig == api.TLSConfig() {
+					t.Fatal("the server shares the TLS configuration returned by TLSConfig")
+				}
+			}
+			if config := api.TLSConfig(); config != nil && len(config.NextProtos) != 0 {
+				t.Errorf("TLSConfig().NextProtos = %v, want none", config.NextProtos)
+			}
+
+			if err := api.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer api.Stop(context.Background())
+			scheme := "http://"
+			if tt.tls {
+				scheme = "https://"
+			}
+			client := &http.Client{Transport: tt.transport()}
+			resp, err := client.Get(scheme + api.ListenAddr().String() + "/proto")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.Proto != tt.wantProto {
+				t.Errorf("protocol = %s, want %s", resp.Proto, tt.wantProto)
+			}
+			if config := api.TLSConfig(); config != nil && len(config.NextProtos) != 0 {
+				t.Errorf("TLSConfig().NextProtos after serving = %v, want none", config.NextProtos)
+			}
+		})
+	}
+}
+
+// tlsTransport returns a transport trusting any certificate and negotiating HTTP/2.
+func tlsTransport() http.RoundTripper {
+	return &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}
+}
+
+// h2cTransport returns a transport speaking HTTP/2 over cleartext connections.
+func h2cTransport() http.RoundTripper {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
@@ -0,0 +1,193 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is an error carrying the information of an RFC 7807 problem details response.
+// Handlers can return it, or pass it to ContextHandler.Error, to control the error response.
+type HTTPError struct {
+	// Type is a URI identifying the problem type, "about:blank" when empty.
+	Type string `json:"type"`
+
+	// Title is a short summary of the problem type, the status text when empty.
+	Title string `json:"title"`
+
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+
+	// Instance is a URI identifying this occurrence of the problem, usually the request path.
+	Instance string `json:"instance,omitempty"`
+
+	// Code is an application specific error code, e.g. "user_not_found".
+	Code string `json:"code,omitempty"`
+
+	// Fields lists the request fields that caused the problem, if any.
+	Fields ValidationErrors `json:"errors,omitempty"`
+
+	// Err is the underlying error. It is logged but never sent to the client.
+	Err error `json:"-"`
+}
+
+// NewHTTPError creates an HTTPError with the given status code and detail.
+func NewHTTPError(status int, detail string) *HTTPError {
+	return &HTTPError{Status: status, Detail: detail}
+}
+
+// Error returns a description of the problem.
+func (e *HTTPError) Error() string {
+	message := fmt.Sprintf("%d %s", e.Status, e.title())
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Unwrap returns the underlying error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the problem.
+func (e *HTTPError) StatusCode() int {
+	return e.Status
+}
+
+// title returns the title of the problem, defaulting to the status text.
+func (e *HTTPError) title() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return http.StatusText(e.Status)
+}
+
+// ErrorRenderer writes the response for an error returned by, or reported from, a handler.
+type ErrorRenderer func(ctx ContextHandler, err error)
+
+// HandlerFuncE defines the type for ContextHandler functions returning an error.
+type HandlerFuncE func(ctx ContextHandler) error
+
+// HandlerWrapperE converts a handler returning an error into a ContextHandler function
+// usable with the N registration methods. A non-nil error is passed to ctx.Error.
+// It is the way to register such handlers, on the server as on route groups: there are no
+// separate registration methods for them.
+//
+//	app.GetN("/users/{id}", server.HandlerWrapperE(getUser))
+//	v1.PostN("/users", server.HandlerWrapperE(createUser))
+func HandlerWrapperE(handler HandlerFuncE) func(ctx ContextHandler) {
+	if handler == nil {
+		return nil
+	}
+	return func(ctx ContextHandler) {
+		if err := handler(ctx); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
+// Error writes the response for err using the error renderer of the server and aborts the handler chain.
+func (ctx *ContextHandler) Error(err error) {
+	renderer := DefaultErrorRenderer
+	if ctx.api != nil && ctx.api.ErrorRenderer != nil {
+		renderer = ctx.api.ErrorRenderer
+	}
+	renderer(*ctx, err)
+	ctx.Abort()
+}
+
+// AsHTTPError converts any error into an *HTTPError:
+//   - an *HTTPError found in the chain is returned as is, or as a copy with status 500 when its
+//     status is not a valid HTTP status code, such as 0 when left unset,
+//   - ValidationErrors become a 422 problem listing the fields,
+//   - errors with a StatusCode() int method, such as *ParamError and *BodyError, keep their status
+//     and use their message as detail,
+//   - ErrUnsupportedMediaType becomes a 415 problem,
+//   - any other error becomes a 500 problem without detail, so that internals are not leaked.
+func AsHTTPError(err error) *HTTPError {
+	var (
+		httpErr   *HTTPError
+		fields    ValidationErrors
+		statusErr interface{ StatusCode() int }
+	)
+	switch {
+	case errors.As(err, &httpErr):
+		if !validStatus(httpErr.Status) {
+			problem := *httpErr
+			problem.Status = http.StatusInternalServerError
+			return &problem
+		}
+		return httpErr
+	case errors.As(err, &fields):
+		return &HTTPError{Status: fields.StatusCode(), Detail: "the request contains invalid fields", Fields: fields, Err: err}
+	case errors.As(err, &statusErr) && validStatus(statusErr.StatusCode()):
+		return &HTTPError{Status: statusErr.StatusCode(), Detail: err.Error(), Err: err}
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return &HTTPError{Status: http.StatusUnsupportedMediaType, Detail: err.Error(), Err: err}
+	}
+	return &HTTPError{Status: http.StatusInternalServerError, Err: err}
+}
+
+// DefaultErrorRenderer writes err as an application/problem+json response, converting it with AsHTTPError.
+// Server errors are logged with the context logger. If the response has already been started,
+// the error is only logged.
+func DefaultErrorRenderer(ctx ContextHandler, err error) {
+	problem := AsHTTPError(err)
+	if problem.Status >= http.StatusInternalServerError || ctx.Response().Written() {
+		ctx.logf("Error handling %s %s: %v", ctx.Request.Method, ctx.Request.URL.Path, err)
+	}
+	if ctx.Response().Written() {
+		return
+	}
+	WriteProblem(ctx.Writer, ctx.Request, problem)
+}
+
+// WriteProblem writes the HTTPError as an application/problem+json response.
+// An invalid status code, such as 0 when left unset, is written as 500.
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem *HTTPError) {
+	body := *problem
+	if !validStatus(body.Status) {
+		body.Status = http.StatusInternalServerError
+	}
+	if body.Type == "" {
+		body.Type = "about:blank"
+	}
+	body.Title = problem.title()
+	if body.Instance == "" && r != nil {
+		body.Instance = r.URL.Path
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"type":"about:blank","title":%q,"status":%d}`, body.Title, body.Status))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(body.Status)
+	w.Write(data)
+}
+
+// validStatus reports whether status is a valid HTTP status code, which WriteHeader accepts.
+func validStatus(status int) bool {
+	return status >= 100 && status <= 599
+}
+
+// logf logs the message with the context logger, if any.
+func (ctx *ContextHandler) logf(format string, args ...interface{}) {
+	if ctx.Logger != nil {
+		ctx.Logger.Printf(format, args...)
+	}
+}
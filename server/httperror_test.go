@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// statusError is an error reporting its own status code.
+type statusError int
+
+func (e statusError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+func TestHandlerWrapperE(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantTitle  string
+		wantCode   string
+	}{
+		{name: "nil", err: nil, wantStatus: http.StatusOK},
+		{name: "http error", err: &HTTPError{Status: http.StatusNotFound, Code: "user_not_found"}, wantStatus: http.StatusNotFound, wantTitle: "Not Found", wantCode: "user_not_found"},
+		{name: "wrapped http error", err: fmt.Errorf("loading: %w", NewHTTPError(http.StatusConflict, "taken")), wantStatus: http.StatusConflict, wantTitle: "Conflict"},
+		{name: "http error without status", err: &HTTPError{Code: "oops", Detail: "bad"}, wantStatus: http.StatusInternalServerError, wantTitle: "Internal Server Error", wantCode: "oops"},
+		{name: "http error with invalid status", err: NewHTTPError(1000, "bad"), wantStatus: http.StatusInternalServerError, wantTitle: "Internal Server Error"},
+		{name: "validation errors", err: ValidationErrors{{Field: "name", Message: "is required"}}, wantStatus: http.StatusUnprocessableEntity, wantTitle: "Unprocessable Entity"},
+		{name: "status error", err: statusError(http.StatusBadRequest), wantStatus: http.StatusBadRequest, wantTitle: "Bad Request"},
+		{name: "status error with invalid status", err: statusError(0), wantStatus: http.StatusInternalServerError, wantTitle: "Internal Server Error"},
+		{name: "unsupported media type", err: ErrUnsupportedMediaType, wantStatus: http.StatusUnsupportedMediaType, wantTitle: "Unsupported Media Type"},
+		{name: "plain error", err: errors.New("database down"), wantStatus: http.StatusInternalServerError, wantTitle: "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.GetN("/test", HandlerWrapperE(func(ctx ContextHandler) error {
+				return tt.err
+			}))
+
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.err == nil {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+			var problem HTTPError
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body, err)
+			}
+			if problem.Status != tt.wantStatus || problem.Title != tt.wantTitle || problem.Code != tt.wantCode {
+				t.Errorf("problem = %+v, want status %d, title %q, code %q", problem, tt.wantStatus, tt.wantTitle, tt.wantCode)
+			}
+			if problem.Instance != "/test" {
+				t.Errorf("instance = %q, want /test", problem.Instance)
+			}
+		})
+	}
+}
+
+func TestAsHTTPErrorKeepsValidError(t *testing.T) {
+	httpErr := NewHTTPError(http.StatusTeapot, "short and stout")
+	if got := AsHTTPError(fmt.Errorf("wrapped: %w", httpErr)); got != httpErr {
+		t.Errorf("AsHTTPError = %p, want the error itself %p", got, httpErr)
+	}
+	unset := &HTTPError{Detail: "bad"}
+	if got := AsHTTPError(unset); got.Status != http.StatusInternalServerError || unset.Status != 0 {
+		t.Errorf("AsHTTPError status = %d and original %d, want 500 without changing the original", got.Status, unset.Status)
+	}
+}
+
+func TestWriteProblemInvalidStatus(t *testing.T) {
+	for _, status := range []int{0, -1, 99, 600} {
+		w := httptest.NewRecorder()
+		WriteProblem(w, nil, &HTTPError{Status: status})
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("WriteProblem with status %d wrote %d, want 500", status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+)
+
+// JSONMarshaler marshals values to JSON. It allows replacing encoding/json with a faster,
+// API compatible codec such as jsoniter or go-json.
+type JSONMarshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// JSONMarshalerFunc adapts an ordinary function, such as json.Marshal, to the JSONMarshaler interface.
+type JSONMarshalerFunc func(v interface{}) ([]byte, error)
+
+// Marshal calls f(v).
+func (f JSONMarshalerFunc) Marshal(v interface{}) ([]byte, error) {
+	return f(v)
+}
+
+// JSONOptions configures the JSON responses written by ContextHandler.JSON and Render.
+type JSONOptions struct {
+	// Indent is the indentation used for every JSON response; responses are compact when empty.
+	Indent string
+
+	// PrettyIndent is the indentation used when the request has the ?pretty=true query parameter,
+	// two spaces when empty.
+	PrettyIndent string
+
+	// DisablePrettyQuery disables the ?pretty=true query parameter.
+	DisablePrettyQuery bool
+
+	// DisableHTMLEscape disables the escaping of <, > and & inside JSON strings.
+	// It only applies to the default encoding/json marshaller; a custom Marshaler controls its own escaping.
+	DisableHTMLEscape bool
+
+	// Marshaler replaces encoding/json for marshalling responses when set.
+	Marshaler JSONMarshaler
+
+	// JSONP determines whether ContextHandler.JSON answers with JSONP when the request carries the callback parameter.
+	// ContextHandler.JSONP always does so.
+	JSONP bool
+
+	// JSONPCallbackParam is the query parameter holding the JSONP callback name, "callback" when empty.
+	JSONPCallbackParam string
+}
+
+// jsonpCallbackPattern matches the callback names accepted for JSONP: JavaScript identifiers,
+// optionally separated by dots, e.g. "handle" or "app.callbacks.handle_1".
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][0-9A-Za-z_$]*(\.[A-Za-z_$][0-9A-Za-z_$]*)*$`)
+
+// maxJSONPCallbackLength is the maximum length of a JSONP callback name.
+const maxJSONPCallbackLength = 128
+
+// IsValidJSONPCallback reports whether the name can safely be used as a JSONP callback.
+func IsValidJSONPCallback(name string) bool {
+	return len(name) <= maxJSONPCallbackLength && jsonpCallbackPattern.MatchString(name)
+}
+
+// jsonOptions returns the JSON options of the server handling the request.
+func (ctx *ContextHandler) jsonOptions() JSONOptions {
+	if ctx.api == nil {
+		return JSONOptions{}
+	}
+	return ctx.api.JSONOptions
+}
+
+// marshalJSON marshals the data according to the JSON options of the server and the ?pretty query parameter.
+func (ctx *ContextHandler) marshalJSON(data interface{}) ([]byte, error) {
+	options := ctx.jsonOptions()
+	indent := options.Indent
+	if !options.DisablePrettyQuery && ctx.Request != nil {
+		if pretty, err := strconv.ParseBool(ctx.Request.URL.Query().Get("pretty")); err == nil && pretty {
+			indent = options.PrettyIndent
+			if indent == "" {
+				indent = "  "
+			}
+		}
+	}
+	return ctx.encodeJSON(data, indent)
+}
+
+// encodeJSON marshals the data with the marshaller and HTML escaping of the server JSON options,
+// indented with the provided indentation, or compact when it is empty.
+func (ctx *ContextHandler) encodeJSON(data interface{}, indent string) ([]byte, error) {
+	options := ctx.jsonOptions()
+
+	// A custom marshaller is indented afterwards
+	if options.Marshaler != nil {
+		jsonBytes, err := options.Marshaler.Marshal(data)
+		if err != nil || indent == "" {
+			return jsonBytes, err
+		}
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, jsonBytes, "", indent); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!options.DisableHTMLEscape)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+	// Encode terminates the value with a newline, which json.Marshal does not
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonpCallback returns the JSONP callback name of the request, or an empty string if there is none.
+func (ctx *ContextHandler) jsonpCallback() string {
+	param := ctx.jsonOptions().JSONPCallbackParam
+	if param == "" {
+		param = "callback"
+	}
+	return ctx.Request.URL.Query().Get(param)
+}
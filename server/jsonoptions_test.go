@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONOptions(t *testing.T) {
+	data := map[string]interface{}{"name": "<b>&</b>", "n": 1}
+	escaped := `{"n":1,"name":"\u003cb\u003e\u0026\u003c/b\u003e"}`
+	wrapping := JSONMarshalerFunc(func(v interface{}) ([]byte, error) {
+		b, err := json.Marshal(v)
+		return []byte(`{"data":` + string(b) + `}`), err
+	})
+	failing := JSONMarshalerFunc(func(v interface{}) ([]byte, error) { return nil, errors.New("marshal failed") })
+
+	tests := []struct {
+		name            string
+		options         JSONOptions
+		jsonp           bool
+		query           string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "compact and escaped by default",
+			wantContentType: "application/json",
+			wantBody:        escaped,
+		},
+		{
+			name:            "HTML escaping disabled",
+			options:         JSONOptions{DisableHTMLEscape: true},
+			wantContentType: "application/json",
+			wantBody:        `{"n":1,"name":"<b>&</b>"}`,
+		},
+		{
+			name:            "indent",
+			options:         JSONOptions{Indent: "\t", DisableHTMLEscape: true},
+			wantContentType: "application/json",
+			wantBody:        "{\n\t\"n\": 1,\n\t\"name\": \"<b>&</b>\"\n}",
+		},
+		{
+			name:            "pretty query",
+			options:         JSONOptions{DisableHTMLEscape: true},
+			query:           "pretty=true",
+			wantContentType: "application/json",
+			wantBody:        "{\n  \"n\": 1,\n  \"name\": \"<b>&</b>\"\n}",
+		},
+		{
+			name:            "pretty query with indent",
+			options:         JSONOptions{PrettyIndent: "    ", DisableHTMLEscape: true},
+			query:           "pretty=1",
+			wantContentType: "application/json",
+			wantBody:        "{\n    \"n\": 1,\n    \"name\": \"<b>&</b>\"\n}",
+		},
+		{
+			name:            "pretty query false",
+			options:         JSONOptions{DisableHTMLEscape: true},
+			query:           "pretty=false",
+			wantContentType: "application/json",
+			wantBody:        `{"n":1,"name":"<b>&</b>"}`,
+		},
+		{
+			name:            "pretty query disabled",
+			options:         JSONOptions{DisablePrettyQuery: true, DisableHTMLEscape: true},
+			query:           "pretty=true",
+			wantContentType: "application/json",
+			wantBody:        `{"n":1,"name":"<b>&</b>"}`,
+		},
+		{
+			name:            "custom marshaller",
+			options:         JSONOptions{Marshaler: wrapping},
+			query:           "pretty=true",
+			wantContentType: "application/json",
+			wantBody:        "{\n  \"data\": {\n    \"n\": 1,\n    \"name\": \"\\u003cb\\u003e\\u0026\\u003c/b\\u003e\"\n  }\n}",
+		},
+		{
+			name:            "marshaller error",
+			options:         JSONOptions{Marshaler: failing},
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/problem+json",
+		},
+		{
+			name:            "callback ignored without JSONP",
+			query:           "callback=handle",
+			wantContentType: "application/json",
+			wantBody:        escaped,
+		},
+		{
+			name:            "JSONP option",
+			options:         JSONOptions{JSONP: true},
+			query:           "callback=app.handle_1",
+			wantContentType: "application/javascript; charset=utf-8",
+			wantBody:        "/**/app.handle_1(" + escaped + ");",
+		},
+		{
+			name:            "JSONP method with custom parameter",
+			options:         JSONOptions{JSONPCallbackParam: "cb", DisableHTMLEscape: true},
+			jsonp:           true,
+			query:           "cb=$handle",
+			wantContentType: "application/javascript; charset=utf-8",
+			wantBody:        `/**/$handle({"n":1,"name":"<b>&</b>"});`,
+		},
+		{
+			name:            "JSONP method without callback",
+			jsonp:           true,
+			wantContentType: "application/json",
+			wantBody:        escaped,
+		},
+		{
+			name:            "invalid callback",
+			jsonp:           true,
+			query:           "callback=alert(1)//",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, &OptionalParams{JSONOptions: tt.options})
+			api.GetN("/data", func(ctx ContextHandler) {
+				if tt.jsonp {
+					ctx.JSONP(data)
+				} else {
+					ctx.JSON(data)
+				}
+			})
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data?"+tt.query, nil))
+
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if w.Code != wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestIsValidJSONPCallback(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"handle", true},
+		{"_handle$1", true},
+		{"app.callbacks.handle", true},
+		{"", false},
+		{"1handle", false},
+		{"app..handle", false},
+		{"handle.", false},
+		{"handle()", false},
+		{"a[0]", false},
+		{"handle;alert(1)", false},
+		{strings.Repeat("a", maxJSONPCallbackLength), true},
+		{strings.Repeat("a", maxJSONPCallbackLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := IsValidJSONPCallback(tt.name); got != tt.want {
+			t.Errorf("IsValidJSONPCallback(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/common-nighthawk/go-figure"
+)
+
+var (
+	// ErrServerStarted is returned when starting a server that has already been started.
+	ErrServerStarted = errors.New("server already started")
+
+	// ErrServerNotStarted is returned when stopping a server that has not been started.
+	ErrServerNotStarted = errors.New("server not started")
+)
+
+// Start validates the configuration, binds the listener and starts serving in the background.
+// It returns once the server accepts connections; configuration and bind errors, such as an address
+// already in use, are returned directly. Use Stop to shut the server down and Done to wait for it.
+func (api *MyAPIServer) Start() error {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	if api.httpServer != nil {
+		return ErrServerStarted
+	}
+
+	// Report every configuration problem collected while registering routes
+	if err := api.Validate(); err != nil {
+		return err
+	}
+
+	// Answer OPTIONS requests for patterns without their own OPTIONS handler
+	api.registerAutoOptions()
+
+	prodServer := api.ConfigureServer(api.ServMConfigure(nil))
+	api.stopping = false
+	return api.startServer(prodServer)
+}
+
+// RunContext starts the server and serves until the context is cancelled, then shuts it down gracefully.
+// It returns the error that stopped the server, or nil after a clean shutdown.
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	err := app.RunContext(ctx)
+func (api *MyAPIServer) RunContext(ctx context.Context) error {
+	if err := api.Start(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		api.Logger.Println("Stopping server:", context.Cause(ctx))
+	case <-api.Done():
+	}
+
+	// Stopping also cleans up after a server that failed while serving
+	stopErr := api.Stop(context.Background())
+	return errors.Join(api.Err(), stopErr)
+}
+
+// Stop shuts the server down gracefully like ShutDown, and waits until it has stopped serving.
+// The context bounds the whole shutdown, in addition to DrainTimeout.
+// Calling Stop again waits for the first call to complete and returns nil.
+func (api *MyAPIServer) Stop(ctx context.Context) error {
+	api.lifecycleMu.Lock()
+	prodServer := api.httpServer
+	if prodServer == nil {
+		// Not marked as stopping, so that stopping the server once started still shuts it down
+		api.lifecycleMu.Unlock()
+		return ErrServerNotStarted
+	}
+	stopping := api.stopping
+	api.stopping = true
+	api.lifecycleMu.Unlock()
+	if stopping {
+		select {
+		case <-api.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	err := api.shutdown(ctx, prodServer)
+	select {
+	case <-api.Done():
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+	}
+	return err
+}
+
+// Done returns a channel closed once the server has stopped serving, after Stop or a serving failure.
+func (api *MyAPIServer) Done() <-chan struct{} {
+	return api.done
+}
+
+// Err returns the error that made the server stop serving, or nil if it is running or was stopped cleanly.
+// http.ErrServerClosed, which only reports a shutdown, is never returned.
+func (api *MyAPIServer) Err() error {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	return api.serveErr
+}
+
+// ListenAddr returns the address of the first listener of the server, or nil before it is started.
+// It reports the actual port when the server was configured with port 0.
+func (api *MyAPIServer) ListenAddr() net.Addr {
+	addrs := api.ListenAddrs()
+	if len(addrs) == 0 {
+		return nil
+	}
+	return addrs[0]
+}
+
+// ListenAddrs returns the addresses of all the listeners of the server, or nil before it is started.
+func (api *MyAPIServer) ListenAddrs() []net.Addr {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	var addrs []net.Addr
+	for _, listener := range api.listeners {
+		addrs = append(addrs, listener.Addr())
+	}
+	return addrs
+}
+
+// startServer opens the listeners and serves on each of them in the background. api.lifecycleMu must be held.
+func (api *MyAPIServer) startServer(prodServer *http.Server) error {
+	if api.httpServer != nil {
+		return ErrServerStarted
+	}
+	listeners, err := api.listen()
+	if err != nil {
+		return err
+	}
+	if err = api.startRedirectServer(listeners); err != nil {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		return err
+	}
+	api.httpServer = prodServer
+	api.listeners = listeners
+	api.handOffs = nil
+
+	myFigure := figure.NewFigure(api.AppName, "", true)
+	myFigure.Print()
+	api.Logger.Printf("version: %v", api.AppVer)
+	api.Logger.Printf("Author: %v", api.AppAuthor)
+	api.logConfig()
+	if prodServer.TLSConfig != nil && api.certReloader != nil && api.TLS.ReloadInterval > 0 {
+		go api.certReloader.watch(api.TLS.ReloadInterval)
+	}
+	api.SetReady(true)
+	api.notifyRestarted()
+
+	// Decided once: http.Server completes its TLSConfig when it starts serving
+	useTLS := prodServer.TLSConfig != nil
+	var wg sync.WaitGroup
+	for _, listener := range listeners {
+		// Served through a handOffListener, which a graceful restart stops without closing the socket
+		handOff := newHandOffListener(listener)
+		api.handOffs = append(api.handOffs, handOff)
+		if useTLS {
+			api.Logger.Printf("Starting HTTPS server at %v", listener.Addr())
+		} else {
+			api.Logger.Printf("Starting server at %v", listener.Addr())
+		}
+		wg.Add(1)
+		go func(listener net.Listener) {
+			defer wg.Done()
+			api.serve(prodServer, listener, useTLS)
+		}(handOff)
+	}
+	go func() {
+		wg.Wait()
+		api.SetReady(false)
+		close(api.done)
+	}()
+	return nil
+}
+
+// serve serves on the listener until the server is shut down. A listener failing for another reason
+// is reported by Err and stops the whole server gracefully.
+func (api *MyAPIServer) serve(prodServer *http.Server, listener net.Listener, useTLS bool) {
+	var err error
+	if useTLS {
+		// The certificates come from the TLS configuration
+		err = prodServer.ServeTLS(listener, "", "")
+	} else {
+		err = prodServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+
+	api.Logger.Printf("Error serving on %v: %v", listener.Addr(), err)
+	api.lifecycleMu.Lock()
+	if api.serveErr == nil {
+		api.serveErr = err
+	}
+	api.lifecycleMu.Unlock()
+	go api.Stop(context.Background())
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStartStop(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopFirst   bool
+		stopTwice   bool
+		wantStopErr error
+	}{
+		{name: "start then stop"},
+		{name: "stop before start", stopFirst: true, wantStopErr: ErrServerNotStarted},
+		{name: "stop twice", stopTwice: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.Get("/ping", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong")) })
+			if tt.stopFirst {
+				if err := api.Stop(context.Background()); !errors.Is(err, tt.wantStopErr) {
+					t.Fatalf("Stop before Start = %v, want %v", err, tt.wantStopErr)
+				}
+			}
+			if err := api.Start(); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if err := api.Start(); !errors.Is(err, ErrServerStarted) {
+				t.Errorf("second Start = %v, want %v", err, ErrServerStarted)
+			}
+
+			resp, err := http.Get("http://" + api.ListenAddr().String() + "/ping")
+			if err != nil {
+				t.Fatalf("GET /ping: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "pong" {
+				t.Errorf("GET /ping body = %q, want %q", body, "pong")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := api.Stop(ctx); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			if tt.stopTwice {
+				if err := api.Stop(ctx); err != nil {
+					t.Errorf("second Stop = %v, want nil", err)
+				}
+			}
+			select {
+			case <-api.Done():
+			default:
+				t.Fatal("Done not closed after Stop")
+			}
+			if api.Ready() {
+				t.Error("Ready after Stop")
+			}
+			if err := api.Err(); err != nil {
+				t.Errorf("Err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	api := newTestServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- api.RunContext(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !api.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("server not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("RunContext = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after the context was cancelled")
+	}
+}
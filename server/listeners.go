@@ -0,0 +1,143 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks addresses of Unix domain sockets, e.g. "unix:/run/app/api.sock".
+const unixPrefix = "unix:"
+
+// listen opens the listeners of the server: the sockets handed over by a graceful restart, or the inherited
+// systemd sockets when SystemdActivation is set and the process was started with some, otherwise Addr and
+// Addrs, followed by the provided Listeners.
+// All the listeners share the same http.Server, and so the same routes and middleware.
+// Listeners already opened are closed when one fails.
+func (api *MyAPIServer) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	fail := func(err error) ([]net.Listener, error) {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		return nil, err
+	}
+
+	// Sockets handed over by a graceful restart take the place of the configured addresses
+	inherited, err := api.inheritListeners()
+	if err != nil {
+		return fail(err)
+	}
+	listeners = append(listeners, inherited...)
+
+	if api.SystemdActivation && len(listeners) == 0 {
+		inherited, err := SystemdListeners()
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, inherited...)
+	}
+	if len(listeners) == 0 {
+		var addrs []string
+		if api.Addr != "" {
+			addrs = append(addrs, api.Addr)
+		}
+		for _, addr := range append(addrs, api.Addrs...) {
+			listener, err := api.listenAddr(addr)
+			if err != nil {
+				return fail(err)
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+	listeners = append(listeners, api.Listeners...)
+	if len(listeners) == 0 {
+		return nil, errors.New("no address to listen on")
+	}
+	return listeners, nil
+}
+
+// listenAddr opens a listener on a TCP address, or on a Unix domain socket for "unix:" addresses.
+func (api *MyAPIServer) listenAddr(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove the socket left behind by a previous process, but never another kind of file
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen unix %s: file exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if api.UnixSocketMode != 0 {
+		if err = os.Chmod(path, api.UnixSocketMode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// SystemdListeners returns the sockets passed by systemd socket activation, as described by the
+// LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables. It returns no listeners when the
+// process was not socket-activated. The variables are removed so that child processes do not inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	return fileListeners(os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+}
+
+// listenFDsStart is the first file descriptor passed by socket activation, after stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// fileListeners turns the count file descriptors starting at listenFDsStart into listeners.
+// names is the colon-separated list of their names, used in errors.
+func fileListeners(count string, names string) ([]net.Listener, error) {
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	fdNames := strings.Split(names, ":")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		file := os.NewFile(uintptr(listenFDsStart+i), name)
+		// FileListener duplicates the descriptor, the original is closed either way
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("inherited socket %s: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
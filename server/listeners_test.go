@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getBody returns the body of a GET request to the URL made with the client.
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestListeners(t *testing.T) {
+	provided, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providedOnly, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      OptionalParams
+		wantCount int
+	}{
+		{name: "Addr", opts: OptionalParams{Addr: "127.0.0.1:0"}, wantCount: 1},
+		{name: "Addr and Addrs", opts: OptionalParams{Addr: "127.0.0.1:0", Addrs: []string{"127.0.0.1:0", "127.0.0.1:0"}}, wantCount: 3},
+		{name: "Addr and Listeners", opts: OptionalParams{Addr: "127.0.0.1:0", Listeners: []net.Listener{provided}}, wantCount: 2},
+		{name: "Listeners only", opts: OptionalParams{Listeners: []net.Listener{providedOnly}}, wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Logger = log.New(io.Discard, "", 0)
+			opts.CollectConfigErrors = true
+			api := NewMyAPIServer(&opts)
+			api.Get("/ping", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong " + r.Host)) })
+			startTestServer(t, api)
+
+			addrs := api.ListenAddrs()
+			if len(addrs) != tt.wantCount {
+				t.Fatalf("ListenAddrs = %v, want %d addresses", addrs, tt.wantCount)
+			}
+			// Every listener serves the same routes
+			for _, addr := range addrs {
+				if body := getBody(t, http.DefaultClient, "http://"+addr.String()+"/ping"); body != "pong "+addr.String() {
+					t.Errorf("GET /ping on %v = %q", addr, body)
+				}
+			}
+			if len(opts.Listeners) > 0 && addrs[len(addrs)-1].String() != opts.Listeners[0].Addr().String() {
+				t.Errorf("provided listener not served last: %v", addrs)
+			}
+		})
+	}
+}
+
+func TestListenErrors(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeAddr := free.Addr().String()
+	free.Close()
+
+	api := newTestServer(t, &OptionalParams{Addr: freeAddr, Addrs: []string{busy.Addr().String()}})
+	if err := api.Start(); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		api.Stop(context.Background())
+		t.Fatalf("Start = %v, want the bind error", err)
+	}
+	// The listener opened before the failure was closed
+	listener, err := net.Listen("tcp", freeAddr)
+	if err != nil {
+		t.Errorf("%s still bound after the failure: %v", freeAddr, err)
+	} else {
+		listener.Close()
+	}
+
+	api = newTestServer(t, nil)
+	api.Addr = ""
+	if err := api.Start(); err == nil || !strings.Contains(err.Error(), "no address to listen on") {
+		t.Errorf("Start without addresses = %v", err)
+	}
+
+	// Without LISTEN_PID for this process, systemd activation falls back to Addr
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	api = newTestServer(t, &OptionalParams{SystemdActivation: true})
+	startTestServer(t, api)
+	if addr, ok := api.ListenAddr().(*net.TCPAddr); !ok || addr.Port == 0 {
+		t.Errorf("ListenAddr = %v, want a TCP address", api.ListenAddr())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	api.Stop(ctx)
+}
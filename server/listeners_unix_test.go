@@ -0,0 +1,161 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// unixClient returns a client sending every request to the Unix domain socket.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestUnixSocket(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing func(path string) error
+		mode     os.FileMode
+		wantErr  string
+	}{
+		{name: "new socket"},
+		{name: "file mode", mode: 0o600},
+		{
+			name: "stale socket",
+			existing: func(path string) error {
+				listener, err := net.Listen("unix", path)
+				if err != nil {
+					return err
+				}
+				// Keep the socket file behind, as a crashed process would
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				return listener.Close()
+			},
+		},
+		{
+			name:     "regular file",
+			existing: func(path string) error { return os.WriteFile(path, []byte("data"), 0o600) },
+			wantErr:  "file exists and is not a socket",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Socket paths are limited to about 100 bytes, shorter than some temporary directories
+			dir, err := os.MkdirTemp("", "sock")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "api.sock")
+			if tt.existing != nil {
+				if err := tt.existing(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			api := newTestServer(t, &OptionalParams{Addrs: []string{"unix:" + path}, UnixSocketMode: tt.mode})
+			api.Get("/ping", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong")) })
+			err = api.Start()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					api.Stop(context.Background())
+					t.Fatalf("Start = %v, want %q", err, tt.wantErr)
+				}
+				if content, _ := os.ReadFile(path); string(content) != "data" {
+					t.Error("existing file modified")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			defer api.Stop(context.Background())
+
+			if body := getBody(t, unixClient(path), "http://unix/ping"); body != "pong" {
+				t.Errorf("GET /ping over the socket = %q", body)
+			}
+			if tt.mode != 0 {
+				info, err := os.Stat(path)
+				if err != nil || info.Mode().Perm() != tt.mode {
+					t.Errorf("socket mode = %v, %v, want %v", info.Mode().Perm(), err, tt.mode)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	if os.Getenv("SERVER_TEST_SYSTEMD_CHILD") == "1" {
+		// Running as the socket-activated process: the socket is file descriptor 3
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		listeners, err := SystemdListeners()
+		if err != nil || len(listeners) != 1 {
+			t.Fatalf("SystemdListeners = %v, %v", listeners, err)
+		}
+		if got, want := listeners[0].Addr().String(), os.Getenv("SERVER_TEST_ADDR"); got != want {
+			t.Errorf("listener address = %s, want %s", got, want)
+		}
+		for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			if _, ok := os.LookupEnv(name); ok {
+				t.Errorf("%s not removed", name)
+			}
+		}
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListeners$", "-test.v")
+	cmd.Env = append(os.Environ(),
+		"SERVER_TEST_SYSTEMD_CHILD=1",
+		"SERVER_TEST_ADDR="+listener.Addr().String(),
+		"LISTEN_FDS=1",
+		"LISTEN_FDNAMES=http",
+	)
+	cmd.ExtraFiles = []*os.File{file}
+	if output, err := cmd.CombinedOutput(); err != nil || !strings.Contains(string(output), "--- PASS: TestSystemdListeners") {
+		t.Fatalf("socket-activated process: %v\n%s", err, output)
+	}
+}
+
+func TestSystemdListenersNotActivated(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{name: "no variables"},
+		{name: "other process", pid: "1", fds: "1"},
+		{name: "no sockets", pid: strconv.Itoa(os.Getpid()), fds: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			if listeners, err := SystemdListeners(); err != nil || len(listeners) != 0 {
+				t.Errorf("SystemdListeners = %v, %v, want none", listeners, err)
+			}
+		})
+	}
+}
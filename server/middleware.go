@@ -28,39 +28,89 @@ func (api *MyAPIServer) MiddlewareChain(middlewares []Middleware) Middleware {
 }
 
 // AddMiddleware adds middleware to the server's middleware list.
+// Standard and ContextHandler middleware can be mixed; they run in the order they were added.
 func (api *MyAPIServer) AddMiddleware(middleware Middleware) {
-	if api.HandlerNew {
-		api.Logger.Fatalf("You need to call this function AddMiddlewareN as HandlerNew flag is set to %v", api.HandlerNew)
+	if middleware == nil {
+		api.configError(&ConfigError{Source: "AddMiddleware", Err: ErrNilMiddleware})
 		return
 	}
 	api.Serv.MiddlewareList = append(api.Serv.MiddlewareList, middleware)
+	api.Serv.middlewareOrder = append(api.Serv.middlewareOrder, false)
 }
 
 // AddMiddlewareN adds converted middleware to the server's middleware list.
+// Standard and ContextHandler middleware can be mixed; they run in the order they were added.
 func (api *MyAPIServer) AddMiddlewareN(middleware MiddlewareN) {
-	if !api.HandlerNew {
-		api.Logger.Fatalf("You need to call this function AddMiddleware as HandlerNew flag is set to %v", api.HandlerNew)
+	if middleware == nil {
+		api.configError(&ConfigError{Source: "AddMiddlewareN", Err: ErrNilMiddleware})
 		return
 	}
-	middlewareCN := MiddlewareWrapperN(middleware)
+	middlewareCN := middlewareWrapperN(middleware, api)
 	api.Serv.MiddlewareListN = append(api.Serv.MiddlewareListN, middlewareCN)
+	api.Serv.middlewareOrder = append(api.Serv.middlewareOrder, true)
+}
+
+// middlewares merges MiddlewareList and MiddlewareListN in the order the middleware was added. Entries of
+// the lists beyond those added with AddMiddleware and AddMiddlewareN follow, and nil entries are skipped.
+func (s *MyServer) middlewares() []MiddlewareConvertedN {
+	merged := make([]MiddlewareConvertedN, 0, len(s.MiddlewareList)+len(s.MiddlewareListN))
+	standard, context := s.MiddlewareList, s.MiddlewareListN
+	for _, isContext := range s.middlewareOrder {
+		if isContext && len(context) > 0 {
+			merged = append(merged, context[0])
+			context = context[1:]
+		} else if !isContext && len(standard) > 0 {
+			merged = append(merged, convertMiddleware(standard[0]))
+			standard = standard[1:]
+		}
+	}
+	merged = append(merged, convertMiddlewares(standard)...)
+	merged = append(merged, context...)
+
+	middlewares := merged[:0]
+	for _, middleware := range merged {
+		if middleware != nil {
+			middlewares = append(middlewares, middleware)
+		}
+	}
+	return middlewares
 }
 
 // MiddlewareWrapperN wraps a middleware function that accepts a ContextHandler.
+// The middleware may call ctx.Next to run the downstream handlers and then inspect the
+// response, or ctx.Abort / ctx.AbortWithStatus to stop the request from going further.
+// If it does neither, the downstream handlers are run once it returns.
 func MiddlewareWrapperN(handler func(ctx ContextHandler)) func(http.Handler) http.Handler {
+	return middlewareWrapperN(handler, nil)
+}
+
+// middlewareWrapperN wraps a ContextHandler middleware, filling the context with the logger and DNS of the server, if any.
+// A nil handler results in a nil middleware, which is reported when the route is registered.
+func middlewareWrapperN(handler func(ctx ContextHandler), api *MyAPIServer) func(http.Handler) http.Handler {
+	if handler == nil {
+		return nil
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Create a ContextHandler with the provided ResponseWriter and Request
+			// Create a ContextHandler whose chain ends with the next handler
 			ctx := ContextHandler{
-				Writer:  w,
+				Writer:  wrapResponseWriter(w),
 				Request: r,
+				api:     api,
+			}
+			if api != nil {
+				ctx.Logger = api.Logger
+				ctx.DNS = api.Dns
 			}
+			ctx.chain = newHandlerChain(handler, func(ctx ContextHandler) {
+				// Call the next handler with the ContextHandler
+				next.ServeHTTP(ctx.Writer, ctx.Request)
+			})
 
 			// Call the middleware function with the ContextHandler
-			handler(ctx)
-
-			// Call the next handler with the ContextHandler
-			next.ServeHTTP(ctx.Writer, ctx.Request)
+			ctx.Next()
+			// Send the status set with ctx.Status if nothing was written
+			ctx.writePendingStatus()
 		})
 	}
 }
@@ -78,3 +128,32 @@ func (api *MyAPIServer) MiddlewareChainN(middleware []MiddlewareConvertedN) func
 		return finalHandler
 	}
 }
+
+// convertMiddleware converts a standard middleware function into a MiddlewareConvertedN.
+// A nil middleware is converted to nil, which is reported when the route is registered.
+func convertMiddleware(middleware Middleware) MiddlewareConvertedN {
+	if middleware == nil {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return middleware(next)
+	}
+}
+
+// convertMiddlewares converts a list of standard middleware functions into MiddlewareConvertedN functions.
+func convertMiddlewares(middlewares []Middleware) []MiddlewareConvertedN {
+	converted := make([]MiddlewareConvertedN, 0, len(middlewares))
+	for _, middleware := range middlewares {
+		converted = append(converted, convertMiddleware(middleware))
+	}
+	return converted
+}
+
+// convertMiddlewaresN converts a list of ContextHandler middleware functions into MiddlewareConvertedN functions.
+func (api *MyAPIServer) convertMiddlewaresN(middlewares []MiddlewareN) []MiddlewareConvertedN {
+	converted := make([]MiddlewareConvertedN, 0, len(middlewares))
+	for _, middleware := range middlewares {
+		converted = append(converted, middlewareWrapperN(middleware, api))
+	}
+	return converted
+}
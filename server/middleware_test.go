@@ -0,0 +1,228 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMixedMiddlewareAndRoutes(t *testing.T) {
+	api := newTestServer(t, nil)
+	var order []string
+	api.AddMiddleware(func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "standard 1")
+			next.ServeHTTP(w, r)
+		}
+	})
+	api.AddMiddlewareN(func(ctx ContextHandler) {
+		order = append(order, "context 2")
+		ctx.Next()
+	})
+	api.AddMiddleware(func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "standard 3")
+			next.ServeHTTP(w, r)
+		}
+	})
+
+	api.Get("/standard", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("standard")) })
+	api.PostN("/context", func(ctx ContextHandler) { ctx.Writer.Write([]byte("context")) })
+	api.HeadN("/context", func(ctx ContextHandler) { ctx.Writer.Header().Set("X-Head", "context") })
+	handler := api.ServMConfigure(nil)
+
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{http.MethodGet, "/standard", http.StatusOK, "standard"},
+		{http.MethodHead, "/standard", http.StatusOK, ""},
+		{http.MethodPost, "/context", http.StatusOK, "context"},
+		{http.MethodHead, "/context", http.StatusOK, ""},
+		{http.MethodGet, "/context", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			order = nil
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+			if got := strings.Join(order, ", "); got != "standard 1, context 2, standard 3" {
+				t.Errorf("middleware order = %s", got)
+			}
+		})
+	}
+}
+
+func TestExportedMiddlewareLists(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			}
+		}
+	}
+	markN := func(name string) MiddlewareN {
+		return func(ctx ContextHandler) { order = append(order, name) }
+	}
+
+	tests := []struct {
+		name      string
+		edit      func(api *MyAPIServer)
+		wantOrder string
+	}{
+		{name: "added", edit: func(api *MyAPIServer) {}, wantOrder: "standard 1, context 2, standard 3"},
+		{
+			name: "appended to the lists",
+			edit: func(api *MyAPIServer) {
+				api.Serv.MiddlewareListN = append(api.Serv.MiddlewareListN, MiddlewareWrapperN(markN("context list")))
+				api.Serv.MiddlewareList = append(api.Serv.MiddlewareList, mark("standard list"))
+			},
+			wantOrder: "standard 1, context 2, standard 3, standard list, context list",
+		},
+		{
+			name:      "replaced",
+			edit:      func(api *MyAPIServer) { api.Serv.MiddlewareList[1] = mark("replaced") },
+			wantOrder: "standard 1, context 2, replaced",
+		},
+		{
+			name:      "removed",
+			edit:      func(api *MyAPIServer) { api.Serv.MiddlewareList = api.Serv.MiddlewareList[1:] },
+			wantOrder: "standard 3, context 2",
+		},
+		{
+			name:      "cleared",
+			edit:      func(api *MyAPIServer) { api.Serv.MiddlewareList, api.Serv.MiddlewareListN = nil, nil },
+			wantOrder: "",
+		},
+		{
+			name:      "nil entry",
+			edit:      func(api *MyAPIServer) { api.Serv.MiddlewareListN[0] = nil },
+			wantOrder: "standard 1, standard 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.AddMiddleware(mark("standard 1"))
+			api.AddMiddlewareN(markN("context 2"))
+			api.AddMiddleware(mark("standard 3"))
+			api.Get("/test", func(w http.ResponseWriter, r *http.Request) {})
+			tt.edit(api)
+
+			order = nil
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+			if got := strings.Join(order, ", "); got != tt.wantOrder {
+				t.Errorf("order = %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			}
+		}
+	}
+	markN := func(name string) MiddlewareN {
+		return func(ctx ContextHandler) { order = append(order, name) }
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }
+	handlerN := func(ctx ContextHandler) { order = append(order, "handler") }
+
+	route := []Middleware{mark("route 1"), mark("route 2")}
+	routeN := []MiddlewareN{markN("route 1"), markN("route 2")}
+
+	tests := []struct {
+		name     string
+		method   string
+		register func(api *MyAPIServer)
+	}{
+		{"Get", http.MethodGet, func(api *MyAPIServer) { api.Get("/route", handler, route...) }},
+		{"Post", http.MethodPost, func(api *MyAPIServer) { api.Post("/route", handler, route...) }},
+		{"Put", http.MethodPut, func(api *MyAPIServer) { api.Put("/route", handler, route...) }},
+		{"Delete", http.MethodDelete, func(api *MyAPIServer) { api.Delete("/route", handler, route...) }},
+		{"Any", http.MethodPatch, func(api *MyAPIServer) { api.Any("/route", handler, route...) }},
+		{"GetN", http.MethodGet, func(api *MyAPIServer) { api.GetN("/route", handlerN, routeN...) }},
+		{"PostN", http.MethodPost, func(api *MyAPIServer) { api.PostN("/route", handlerN, routeN...) }},
+		{"PutN", http.MethodPut, func(api *MyAPIServer) { api.PutN("/route", handlerN, routeN...) }},
+		{"DeleteN", http.MethodDelete, func(api *MyAPIServer) { api.DeleteN("/route", handlerN, routeN...) }},
+		{"AnyN", http.MethodPatch, func(api *MyAPIServer) { api.AnyN("/route", handlerN, routeN...) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.AddMiddleware(mark("server 1"))
+			api.AddMiddlewareN(markN("server 2"))
+			tt.register(api)
+			api.Match([]string{tt.method}, "/other", handler)
+			serverHandler := api.ServMConfigure(nil)
+
+			for path, want := range map[string]string{
+				"/route": "server 1, server 2, route 1, route 2, handler",
+				"/other": "server 1, server 2, handler",
+			} {
+				order = nil
+				w := httptest.NewRecorder()
+				serverHandler.ServeHTTP(w, httptest.NewRequest(tt.method, path, nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("%s %s: status = %d", tt.method, path, w.Code)
+				}
+				if got := strings.Join(order, ", "); got != want {
+					t.Errorf("%s %s: order = %s, want %s", tt.method, path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteMiddlewareAbort(t *testing.T) {
+	api := newTestServer(t, nil)
+	called := false
+	requireToken := func(ctx ContextHandler) {
+		if ctx.Request.Header.Get("X-Token") != "secret" {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	api.DeleteN("/users/{id}", func(ctx ContextHandler) {
+		called = true
+		ctx.Writer.WriteHeader(http.StatusNoContent)
+	}, requireToken)
+	handler := api.ServMConfigure(nil)
+
+	tests := []struct {
+		token      string
+		wantStatus int
+		wantCalled bool
+	}{
+		{"", http.StatusUnauthorized, false},
+		{"wrong", http.StatusUnauthorized, false},
+		{"secret", http.StatusNoContent, true},
+	}
+	for _, tt := range tests {
+		called = false
+		r := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		r.Header.Set("X-Token", tt.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus || called != tt.wantCalled {
+			t.Errorf("token %q: status = %d, handler called = %v, want %d, %v", tt.token, w.Code, called, tt.wantStatus, tt.wantCalled)
+		}
+	}
+}
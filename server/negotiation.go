@@ -0,0 +1,319 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Encoder writes a value in a given media type.
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// Decoder reads a value from a given media type.
+type Decoder interface {
+	Decode(r io.Reader, v interface{}) error
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+// Encode calls f(w, v).
+func (f EncoderFunc) Encode(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// DecoderFunc adapts an ordinary function to the Decoder interface.
+type DecoderFunc func(r io.Reader, v interface{}) error
+
+// Decode calls f(r, v).
+func (f DecoderFunc) Decode(r io.Reader, v interface{}) error {
+	return f(r, v)
+}
+
+// Media types of the built-in encoders and decoders.
+const (
+	MediaTypeJSON    = "application/json"
+	MediaTypeXML     = "application/xml"
+	MediaTypeYAML    = "application/yaml"
+	MediaTypeMsgPack = "application/msgpack"
+	MediaTypeCBOR    = "application/cbor"
+	MediaTypeNDJSON  = "application/x-ndjson"
+)
+
+// codecRegistry holds the encoders and decoders of a server keyed by media type.
+type codecRegistry struct {
+	// encoders maps a media type to its encoder.
+	encoders map[string]Encoder
+
+	// encoderOrder lists the media types of the encoders by preference, the first being the default.
+	encoderOrder []string
+
+	// decoders maps a media type to its decoder.
+	decoders map[string]Decoder
+
+	// customJSON records whether the built-in JSON encoder has been replaced.
+	// The built-in one is bypassed by Render in favour of ContextHandler.JSON and the server JSONOptions.
+	customJSON bool
+}
+
+// newCodecRegistry creates a registry holding the built-in encoders and decoders.
+func newCodecRegistry() *codecRegistry {
+	registry := &codecRegistry{encoders: make(map[string]Encoder), decoders: make(map[string]Decoder)}
+
+	jsonEncoder := EncoderFunc(func(w io.Writer, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	jsonDecoder := DecoderFunc(func(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) })
+	xmlEncoder := EncoderFunc(func(w io.Writer, v interface{}) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		return xml.NewEncoder(w).Encode(v)
+	})
+	xmlDecoder := DecoderFunc(func(r io.Reader, v interface{}) error { return xml.NewDecoder(r).Decode(v) })
+	yamlEncoder := EncoderFunc(func(w io.Writer, v interface{}) error {
+		enc := yaml.NewEncoder(w)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	})
+	yamlDecoder := DecoderFunc(func(r io.Reader, v interface{}) error { return yaml.NewDecoder(r).Decode(v) })
+	msgpackEncoder := EncoderFunc(func(w io.Writer, v interface{}) error { return msgpack.NewEncoder(w).Encode(v) })
+	msgpackDecoder := DecoderFunc(func(r io.Reader, v interface{}) error { return msgpack.NewDecoder(r).Decode(v) })
+	cborEncoder := EncoderFunc(func(w io.Writer, v interface{}) error { return cbor.NewEncoder(w).Encode(v) })
+	cborDecoder := DecoderFunc(func(r io.Reader, v interface{}) error { return cbor.NewDecoder(r).Decode(v) })
+
+	registry.register(MediaTypeJSON, jsonEncoder, jsonDecoder)
+	registry.register(MediaTypeXML, xmlEncoder, xmlDecoder)
+	registry.register(MediaTypeYAML, yamlEncoder, yamlDecoder)
+	registry.register(MediaTypeMsgPack, msgpackEncoder, msgpackDecoder)
+	registry.register(MediaTypeCBOR, cborEncoder, cborDecoder)
+
+	// Common aliases are accepted for decoding only, responses use the canonical media types
+	registry.decoders["text/xml"] = xmlDecoder
+	registry.decoders["application/x-yaml"] = yamlDecoder
+	registry.decoders["text/yaml"] = yamlDecoder
+	registry.decoders["application/x-msgpack"] = msgpackDecoder
+	registry.decoders["application/vnd.msgpack"] = msgpackDecoder
+	return registry
+}
+
+// register adds an encoder and a decoder for the media type; either may be nil.
+func (registry *codecRegistry) register(mediaType string, encoder Encoder, decoder Decoder) {
+	if encoder != nil {
+		if _, ok := registry.encoders[mediaType]; !ok {
+			registry.encoderOrder = append(registry.encoderOrder, mediaType)
+		}
+		registry.encoders[mediaType] = encoder
+	}
+	if decoder != nil {
+		registry.decoders[mediaType] = decoder
+	}
+}
+
+// decoder returns the decoder for the media type, falling back to the structured syntax suffix,
+// e.g. the JSON decoder for application/vnd.api+json.
+func (registry *codecRegistry) decoder(mediaType string) (Decoder, bool) {
+	if decoder, ok := registry.decoders[mediaType]; ok {
+		return decoder, true
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		decoder, ok := registry.decoders["application/"+mediaType[i+1:]]
+		return decoder, ok
+	}
+	return nil, false
+}
+
+// codecs returns the encoder and decoder registry of the server, creating it on first use.
+// Concurrent requests may be the first to use it, so it is created once.
+func (api *MyAPIServer) codecs() *codecRegistry {
+	api.codecOnce.Do(func() {
+		api.codecRegistry = newCodecRegistry()
+	})
+	return api.codecRegistry
+}
+
+// RegisterEncoder registers the encoder used by Render for the media type, replacing any existing one.
+// New media types are preferred after the already registered ones when the client accepts several equally.
+func (api *MyAPIServer) RegisterEncoder(mediaType string, encoder Encoder) {
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == MediaTypeJSON {
+		api.codecs().customJSON = true
+	}
+	api.codecs().register(mediaType, encoder, nil)
+}
+
+// RegisterDecoder registers the decoder used by Bind and Decode for the media type, replacing any existing one.
+func (api *MyAPIServer) RegisterDecoder(mediaType string, decoder Decoder) {
+	api.codecs().register(strings.ToLower(mediaType), nil, decoder)
+}
+
+// registry returns the codec registry of the server handling the request.
+func (ctx *ContextHandler) registry() *codecRegistry {
+	if ctx.api == nil {
+		return newCodecRegistry()
+	}
+	return ctx.api.codecs()
+}
+
+// Render writes data in the media type preferred by the client according to the Accept header,
+// among the media types of the registered encoders. JSON is used when the request has no Accept header.
+// A 406 Not Acceptable error is written through the error renderer when no encoder is acceptable.
+// JSON follows the server JSONOptions, including ?pretty=true, unless its encoder was replaced.
+func (ctx *ContextHandler) Render(data interface{}) {
+	registry := ctx.registry()
+	mediaType := NegotiateMediaType(ctx.Request.Header.Get("Accept"), registry.encoderOrder)
+	if mediaType == "" {
+		ctx.Error(NewHTTPError(http.StatusNotAcceptable, "none of the accepted media types can be produced, available: "+strings.Join(registry.encoderOrder, ", ")))
+		return
+	}
+	ctx.Writer.Header().Add("Vary", "Accept")
+	// JSON follows the server JSONOptions unless its encoder was replaced
+	if mediaType == MediaTypeJSON && !registry.customJSON {
+		jsonBytes, err := ctx.marshalJSON(data)
+		if err != nil {
+			ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: fmt.Errorf("encoding %s: %w", mediaType, err)})
+			return
+		}
+		ctx.Writer.Header().Set("Content-Type", mediaType)
+		ctx.Writer.Write(jsonBytes)
+		return
+	}
+
+	// Encode into a buffer first so that encoding errors can still be answered with a 500
+	var buf bytes.Buffer
+	if err := registry.encoders[mediaType].Encode(&buf, data); err != nil {
+		ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: fmt.Errorf("encoding %s: %w", mediaType, err)})
+		return
+	}
+	ctx.Writer.Header().Set("Content-Type", mediaType)
+	ctx.Writer.Write(buf.Bytes())
+}
+
+// RenderStatus writes data like Render with the provided status code.
+func (ctx *ContextHandler) RenderStatus(code int, data interface{}) {
+	ctx.Status(code)
+	ctx.Render(data)
+}
+
+// Decode decodes the request body into v with the decoder registered for the request Content-Type.
+// The body is limited to the size configured with MaxBodyBytes or BodyLimit.
+// It returns ErrUnsupportedMediaType when no decoder is registered for the Content-Type.
+func (ctx *ContextHandler) Decode(v interface{}) error {
+	decoder, ok := ctx.registry().decoder(mediaType(ctx.Request))
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedMediaType, ctx.Request.Header.Get("Content-Type"))
+	}
+	ctx.limitBody()
+	defer ctx.Request.Body.Close()
+	if err := decoder.Decode(ctx.Request.Body, v); err != nil {
+		if err == io.EOF {
+			return &BodyError{Kind: ErrEmptyBody, Err: err}
+		}
+		return ctx.bodyError(nil, err)
+	}
+	return nil
+}
+
+// NegotiateMediaType returns the offered media type preferred by the Accept header value,
+// honouring quality values and wildcards, or an empty string if none is acceptable.
+// The first offer is returned when the header is empty. Offers that are equally acceptable
+// are chosen in the order they are given.
+func NegotiateMediaType(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := -1.0, -1
+		for _, r := range ranges {
+			if s := r.matches(offer); s > specificity {
+				quality, specificity = r.quality, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+// acceptRange is a media range of an Accept header with its quality value.
+type acceptRange struct {
+	// typ and subtype are the parts of the media range, either of which may be "*".
+	typ, subtype string
+
+	// quality is the q parameter of the range, 1 by default.
+	quality float64
+}
+
+// matches returns the specificity of the range for the media type: 2 for an exact match,
+// 1 for a type/* match, 0 for */* and -1 if the range does not match.
+func (r acceptRange) matches(mediaType string) int {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	switch {
+	case r.typ == "*" && r.subtype == "*":
+		return 0
+	case r.typ == typ && r.subtype == "*":
+		return 1
+	case r.typ == typ && r.subtype == subtype:
+		return 2
+	}
+	return -1
+}
+
+// parseAccept parses the media ranges of an Accept header value, skipping malformed ones.
+// Quality values outside 0..1 are invalid and make the range not acceptable, like q=0.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(media, "/")
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+			if !(quality >= 0 && quality <= 1) {
+				quality = 0
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, quality: quality})
+	}
+	return ranges
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRenderNegotiation(t *testing.T) {
+	tests := []struct {
+		accept     string
+		wantStatus int
+		wantType   string
+	}{
+		{accept: "", wantStatus: http.StatusOK, wantType: MediaTypeJSON},
+		{accept: "*/*", wantStatus: http.StatusOK, wantType: MediaTypeJSON},
+		{accept: "application/xml", wantStatus: http.StatusOK, wantType: MediaTypeXML},
+		{accept: "application/yaml;q=0.5, application/cbor", wantStatus: http.StatusOK, wantType: MediaTypeCBOR},
+		{accept: "text/csv", wantStatus: http.StatusNotAcceptable, wantType: "application/problem+json"},
+		{accept: "application/xml;q=5, application/cbor;q=0.9", wantStatus: http.StatusOK, wantType: MediaTypeCBOR},
+		{accept: "application/xml;q=-1, application/yaml;q=0.1", wantStatus: http.StatusOK, wantType: MediaTypeYAML},
+		{accept: "application/xml;q=NaN", wantStatus: http.StatusNotAcceptable, wantType: "application/problem+json"},
+	}
+
+	api := newTestServer(t, nil)
+	type item struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+	api.GetN("/item", func(ctx ContextHandler) { ctx.Render(item{Name: "widget"}) })
+	handler := api.ServMConfigure(nil)
+
+	// The first requests are concurrent, to check that the codec registry is created once
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, tt := range tests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/item", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			<-start
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Accept %q: status = %d, want %d", tt.accept, w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Accept %q: Content-Type = %q, want %q", tt.accept, got, tt.wantType)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
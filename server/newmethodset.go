@@ -6,62 +6,99 @@
 
 package server
 
+import "net/http"
+
 // GetN registers a handler function for the GET method with the specified URL pattern.
-// This method is intended to be used when creating new handler functions that accept a ContextHandler.
-// If HandlerNew flag is set to false, log a fatal error message and return.
-// The handler function should accept a ContextHandler as input.
-func (api *MyAPIServer) GetN(pattern string, myHandler func(ctx ContextHandler)) {
-	// Check if the new handler functions should be used
-	if !api.HandlerNew {
-		// If not, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function Get as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Get, Post, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) GetN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
 	// Register the handler function for the GET method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("GET "+pattern, api.handlerWrapper(myHandler))
+	api.register(http.MethodGet, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
 }
 
 // PostN registers a handler function for the POST method with the specified URL pattern.
-// This method is intended to be used when creating new handler functions that accept a ContextHandler.
-// If HandlerNew flag is set to false, log a fatal error message and return.
-// The handler function should accept a ContextHandler as input.
-func (api *MyAPIServer) PostN(pattern string, myHandler func(ctx ContextHandler)) {
-	// Check if the new handler functions should be used
-	if !api.HandlerNew {
-		// If not, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function Post as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Post, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) PostN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
 	// Register the handler function for the POST method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("POST "+pattern, api.handlerWrapper(myHandler))
+	api.register(http.MethodPost, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
 }
 
 // PutN registers a handler function for the PUT method with the specified URL pattern.
-// This method is intended to be used when creating new handler functions that accept a ContextHandler.
-// If HandlerNew flag is set to false, log a fatal error message and return.
-// The handler function should accept a ContextHandler as input.
-func (api *MyAPIServer) PutN(pattern string, myHandler func(ctx ContextHandler)) {
-	// Check if the new handler functions should be used
-	if !api.HandlerNew {
-		// If not, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function Put as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Put, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) PutN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
 	// Register the handler function for the PUT method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("PUT "+pattern, api.handlerWrapper(myHandler))
+	api.register(http.MethodPut, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
 }
 
 // DeleteN registers a handler function for the DELETE method with the specified URL pattern.
-// This method is intended to be used when creating new handler functions that accept a ContextHandler.
-// If HandlerNew flag is set to false, log a fatal error message and return.
-// The handler function should accept a ContextHandler as input.
-func (api *MyAPIServer) DeleteN(pattern string, myHandler func(ctx ContextHandler)) {
-	// Check if the new handler functions should be used
-	if !api.HandlerNew {
-		// If not, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function Delete as HandlerNew flag is set to %v", api.HandlerNew)
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Delete, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) DeleteN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the DELETE method with the ServeMux
+	api.register(http.MethodDelete, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// PatchN registers a handler function for the PATCH method with the specified URL pattern.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Patch, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) PatchN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the PATCH method with the ServeMux
+	api.register(http.MethodPatch, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// HeadN registers a handler function for the HEAD method with the specified URL pattern.
+// GET routes already answer HEAD requests, so HeadN is only needed to override that behaviour.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Head, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) HeadN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the HEAD method with the ServeMux
+	api.register(http.MethodHead, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// OptionsN registers a handler function for the OPTIONS method with the specified URL pattern.
+// Patterns without an OPTIONS route answer OPTIONS requests automatically with an Allow header.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Options, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) OptionsN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the OPTIONS method with the ServeMux
+	api.register(http.MethodOptions, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// ConnectN registers a handler function for the CONNECT method with the specified URL pattern.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Connect, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) ConnectN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the CONNECT method with the ServeMux
+	api.register(http.MethodConnect, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// TraceN registers a handler function for the TRACE method with the specified URL pattern.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Trace, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) TraceN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	// Register the handler function for the TRACE method with the ServeMux
+	api.register(http.MethodTrace, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// AnyN registers a handler function for every standard HTTP method with the specified URL pattern.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Any, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) AnyN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	api.MatchN(AnyMethods, pattern, myHandler, middlewares...)
+}
+
+// MatchN registers a handler function for each of the given HTTP methods with the specified URL pattern.
+// The handler function should accept a ContextHandler as input and can be mixed with standard routes (Match, Get, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) MatchN(methods []string, pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	if len(methods) == 0 {
+		api.configError(&ConfigError{Source: "MatchN", Pattern: pattern, Err: ErrNoMethods})
 		return
 	}
-	// Register the handler function for the DELETE method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("DELETE "+pattern, api.handlerWrapper(myHandler))
+	// Register the handler function for each method with the ServeMux
+	for _, method := range methods {
+		api.register(method, pattern, api.handlerWrapper(myHandler), api.convertMiddlewaresN(middlewares))
+	}
 }
@@ -9,57 +9,96 @@ package server
 import "net/http"
 
 // Get registers a handler function for the GET method with the specified URL pattern.
-// If HandlerNew flag is set to true, use the new handler functions (GetN, PostN, etc.) instead.
-// If HandlerNew flag is set to false, use the standard handler functions (Get, Post, etc.).
-func (api *MyAPIServer) Get(pattern string, myHandler func(http.ResponseWriter, *http.Request)) {
-	// Check if the new handler functions should be used
-	if api.HandlerNew {
-		// If so, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function GetN as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (GetN, PostN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Get(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
 	// Register the handler function for the GET method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("GET "+pattern, myHandler)
+	api.register(http.MethodGet, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
 }
 
 // Post registers a handler function for the POST method with the specified URL pattern.
-// If HandlerNew flag is set to true, use the new handler functions (PostN, GetN, etc.) instead.
-// If HandlerNew flag is set to false, use the standard handler functions (Post, Get, etc.).
-func (api *MyAPIServer) Post(pattern string, myHandler func(http.ResponseWriter, *http.Request)) {
-	// Check if the new handler functions should be used
-	if api.HandlerNew {
-		// If so, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function PostN as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (PostN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Post(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
 	// Register the handler function for the POST method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("POST "+pattern, myHandler)
+	api.register(http.MethodPost, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
 }
 
 // Put registers a handler function for the PUT method with the specified URL pattern.
-// If HandlerNew flag is set to true, use the new handler functions (PutN, GetN, etc.) instead.
-// If HandlerNew flag is set to false, use the standard handler functions (Put, Get, etc.).
-func (api *MyAPIServer) Put(pattern string, myHandler func(http.ResponseWriter, *http.Request)) {
-	// Check if the new handler functions should be used
-	if api.HandlerNew {
-		// If so, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function PutN as HandlerNew flag is set to %v", api.HandlerNew)
-		return
-	}
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (PutN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Put(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
 	// Register the handler function for the PUT method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("PUT "+pattern, myHandler)
+	api.register(http.MethodPut, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
 }
 
 // Delete registers a handler function for the DELETE method with the specified URL pattern.
-// If HandlerNew flag is set to true, use the new handler functions (DeleteN, GetN, etc.) instead.
-// If HandlerNew flag is set to false, use the standard handler functions (Delete, Get, etc.).
-func (api *MyAPIServer) Delete(pattern string, myHandler func(http.ResponseWriter, *http.Request)) {
-	// Check if the new handler functions should be used
-	if api.HandlerNew {
-		// If so, log a fatal error message and return
-		api.Logger.Fatalf("You need to call this function DeleteN as HandlerNew flag is set to %v", api.HandlerNew)
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (DeleteN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Delete(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the DELETE method with the ServeMux
+	api.register(http.MethodDelete, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Patch registers a handler function for the PATCH method with the specified URL pattern.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (PatchN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Patch(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the PATCH method with the ServeMux
+	api.register(http.MethodPatch, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Head registers a handler function for the HEAD method with the specified URL pattern.
+// GET routes already answer HEAD requests, so Head is only needed to override that behaviour.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (HeadN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Head(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the HEAD method with the ServeMux
+	api.register(http.MethodHead, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Options registers a handler function for the OPTIONS method with the specified URL pattern.
+// Patterns without an OPTIONS route answer OPTIONS requests automatically with an Allow header.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (OptionsN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Options(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the OPTIONS method with the ServeMux
+	api.register(http.MethodOptions, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Connect registers a handler function for the CONNECT method with the specified URL pattern.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (ConnectN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Connect(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the CONNECT method with the ServeMux
+	api.register(http.MethodConnect, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Trace registers a handler function for the TRACE method with the specified URL pattern.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (TraceN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Trace(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	// Register the handler function for the TRACE method with the ServeMux
+	api.register(http.MethodTrace, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// Any registers a handler function for every standard HTTP method with the specified URL pattern.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (AnyN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Any(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	api.Match(AnyMethods, pattern, myHandler, middlewares...)
+}
+
+// Match registers a handler function for each of the given HTTP methods with the specified URL pattern.
+// The handler is a standard http.HandlerFunc and can be mixed with ContextHandler routes (MatchN, GetN, etc.).
+// The optional middlewares only apply to this route and run after the server and group middleware.
+func (api *MyAPIServer) Match(methods []string, pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	if len(methods) == 0 {
+		api.configError(&ConfigError{Source: "Match", Pattern: pattern, Err: ErrNoMethods})
 		return
 	}
-	// Register the handler function for the DELETE method with the ServeMux
-	api.Serv.ServeMux.HandleFunc("DELETE "+pattern, myHandler)
+	// Register the handler function for each method with the ServeMux
+	for _, method := range methods {
+		api.register(method, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+	}
 }
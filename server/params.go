@@ -0,0 +1,129 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamError describes a request parameter that could not be converted to the expected type.
+// It is meant to be returned to the client as a 400 Bad Request response.
+type ParamError struct {
+	// In is the location of the parameter: "path", "query", "header" or "form".
+	In string `json:"in"`
+
+	// Name is the name of the parameter.
+	Name string `json:"name"`
+
+	// Value is the raw value received for the parameter.
+	Value string `json:"value"`
+
+	// Type is the name of the type the value was expected to convert to.
+	Type string `json:"type"`
+
+	// Err is the underlying conversion error.
+	Err error `json:"-"`
+}
+
+// Error returns a description of the invalid parameter.
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s parameter %q: %q is not a valid %s", e.In, e.Name, e.Value, e.Type)
+}
+
+// Unwrap returns the underlying conversion error.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code matching the error, 400 Bad Request.
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Param returns the value of the path wildcard with the given name, e.g. "id" for the pattern /users/{id}.
+// It returns an empty string if the pattern has no such wildcard.
+func (ctx *ContextHandler) Param(name string) string {
+	return ctx.Request.PathValue(name)
+}
+
+// ParamInt returns the value of the path wildcard with the given name converted to an int.
+func (ctx *ContextHandler) ParamInt(name string) (int, error) {
+	value := ctx.Param(name)
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ParamError{In: "path", Name: name, Value: value, Type: "int", Err: err}
+	}
+	return i, nil
+}
+
+// ParamInt64 returns the value of the path wildcard with the given name converted to an int64.
+func (ctx *ContextHandler) ParamInt64(name string) (int64, error) {
+	value := ctx.Param(name)
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &ParamError{In: "path", Name: name, Value: value, Type: "int64", Err: err}
+	}
+	return i, nil
+}
+
+// ParamUUID returns the value of the path wildcard with the given name after checking it is a UUID
+// in the 8-4-4-4-12 hexadecimal form. The UUID is returned in lower case.
+func (ctx *ContextHandler) ParamUUID(name string) (string, error) {
+	value := ctx.Param(name)
+	if !isUUID(value) {
+		return "", &ParamError{In: "path", Name: name, Value: value, Type: "uuid", Err: errInvalidUUID}
+	}
+	return strings.ToLower(value), nil
+}
+
+// ParamTime returns the value of the path wildcard with the given name parsed with the given layout,
+// e.g. time.RFC3339 or time.DateOnly.
+func (ctx *ContextHandler) ParamTime(name string, layout string) (time.Time, error) {
+	value := ctx.Param(name)
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, &ParamError{In: "path", Name: name, Value: value, Type: "time", Err: err}
+	}
+	return t, nil
+}
+
+// BindPath fills the fields of the struct pointed to by v from the path wildcards,
+// using the field tag `path:"name"` to select the wildcard. Fields without the tag,
+// and fields whose wildcard is empty and have no default tag, are left unchanged.
+func (ctx *ContextHandler) BindPath(v interface{}) error {
+	return bindValues(v, "path", func(name string) ([]string, bool) {
+		value := ctx.Request.PathValue(name)
+		if value == "" {
+			return nil, false
+		}
+		return []string{value}, true
+	}, nil)
+}
+
+// isUUID reports whether s is a UUID in the 8-4-4-4-12 hexadecimal form.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
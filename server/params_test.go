@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveParam serves a GET request for the path on a route with the pattern and calls fn with its context.
+func serveParam(t *testing.T, pattern string, path string, fn func(ctx ContextHandler)) {
+	t.Helper()
+	api := newTestServer(t, nil)
+	called := false
+	api.GetN(pattern, func(ctx ContextHandler) {
+		called = true
+		fn(ctx)
+	})
+	api.ServMConfigure(nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	if !called {
+		t.Fatalf("GET %s did not match %s", path, pattern)
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		get      func(ctx ContextHandler) (interface{}, error)
+		want     interface{}
+		wantType string
+	}{
+		{
+			name:    "Param",
+			pattern: "/users/{id}",
+			path:    "/users/abc",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.Param("id"), nil },
+			want:    "abc",
+		},
+		{
+			name:    "Param missing",
+			pattern: "/users/{id}",
+			path:    "/users/abc",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.Param("name"), nil },
+			want:    "",
+		},
+		{
+			name:    "Param remaining segments",
+			pattern: "/files/{path...}",
+			path:    "/files/a/b.txt",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.Param("path"), nil },
+			want:    "a/b.txt",
+		},
+		{
+			name:    "ParamInt",
+			pattern: "/users/{id}",
+			path:    "/users/-42",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.ParamInt("id") },
+			want:    -42,
+		},
+		{
+			name:     "ParamInt invalid",
+			pattern:  "/users/{id}",
+			path:     "/users/4x2",
+			get:      func(ctx ContextHandler) (interface{}, error) { return ctx.ParamInt("id") },
+			wantType: "int",
+		},
+		{
+			name:    "ParamInt64",
+			pattern: "/users/{id}",
+			path:    "/users/9007199254740993",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.ParamInt64("id") },
+			want:    int64(9007199254740993),
+		},
+		{
+			name:     "ParamInt64 overflow",
+			pattern:  "/users/{id}",
+			path:     "/users/92233720368547758070",
+			get:      func(ctx ContextHandler) (interface{}, error) { return ctx.ParamInt64("id") },
+			wantType: "int64",
+		},
+		{
+			name:    "ParamUUID",
+			pattern: "/orders/{id}",
+			path:    "/orders/3F2504E0-4F89-11D3-9A0C-0305E82C3301",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.ParamUUID("id") },
+			want:    "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+		},
+		{
+			name:     "ParamUUID invalid",
+			pattern:  "/orders/{id}",
+			path:     "/orders/3f2504e0-4f89-11d3-9a0c-0305e82c330g",
+			get:      func(ctx ContextHandler) (interface{}, error) { return ctx.ParamUUID("id") },
+			wantType: "uuid",
+		},
+		{
+			name:    "ParamTime",
+			pattern: "/reports/{day}",
+			path:    "/reports/2024-02-29",
+			get:     func(ctx ContextHandler) (interface{}, error) { return ctx.ParamTime("day", time.DateOnly) },
+			want:    time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "ParamTime invalid",
+			pattern:  "/reports/{day}",
+			path:     "/reports/2023-02-29",
+			get:      func(ctx ContextHandler) (interface{}, error) { return ctx.ParamTime("day", time.DateOnly) },
+			wantType: "time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveParam(t, tt.pattern, tt.path, func(ctx ContextHandler) {
+				got, err := tt.get(ctx)
+				if tt.wantType == "" {
+					if err != nil || got != tt.want {
+						t.Errorf("got %v, %v, want %v", got, err, tt.want)
+					}
+					return
+				}
+				var paramErr *ParamError
+				if !errors.As(err, &paramErr) {
+					t.Fatalf("error = %v, want a *ParamError", err)
+				}
+				if paramErr.In != "path" || paramErr.Type != tt.wantType || paramErr.StatusCode() != http.StatusBadRequest {
+					t.Errorf("ParamError = %+v, status %d", paramErr, paramErr.StatusCode())
+				}
+			})
+		})
+	}
+}
+
+func TestBindPath(t *testing.T) {
+	type target struct {
+		ID      int       `path:"id"`
+		Day     time.Time `path:"day" time_format:"2006-01-02"`
+		Version string    `path:"version" default:"v1"`
+		Other   string
+	}
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    target
+		wantErr bool
+	}{
+		{
+			name:    "all wildcards",
+			pattern: "/{version}/users/{id}/{day}",
+			path:    "/v2/users/7/2024-01-31",
+			want:    target{ID: 7, Day: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), Version: "v2", Other: "kept"},
+		},
+		{
+			name:    "default",
+			pattern: "/users/{id}/{day}",
+			path:    "/users/7/2024-01-31",
+			want:    target{ID: 7, Day: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), Version: "v1", Other: "kept"},
+		},
+		{
+			name:    "invalid",
+			pattern: "/users/{id}/{day}",
+			path:    "/users/seven/2024-01-31",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveParam(t, tt.pattern, tt.path, func(ctx ContextHandler) {
+				got := target{Other: "kept"}
+				err := ctx.BindPath(&got)
+				if tt.wantErr {
+					var paramErr *ParamError
+					if !errors.As(err, &paramErr) || paramErr.Name != "id" {
+						t.Errorf("BindPath = %v, want a ParamError for id", err)
+					}
+					return
+				}
+				if err != nil || got != tt.want {
+					t.Errorf("BindPath = %+v, %v, want %+v", got, err, tt.want)
+				}
+			})
+		})
+	}
+
+	serveParam(t, "/users/{id}", "/users/1", func(ctx ContextHandler) {
+		var notStruct int
+		if err := ctx.BindPath(&notStruct); !errors.Is(err, ErrBindTarget) {
+			t.Errorf("BindPath(*int) = %v, want ErrBindTarget", err)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Status sets the status code of the response. The status is sent with the first write of the body,
+// so that headers such as Content-Type can still be set, or when the handler returns without writing.
+func (ctx *ContextHandler) Status(code int) {
+	if rw, ok := ctx.Writer.(*responseWriter); ok {
+		rw.pending = code
+		return
+	}
+	ctx.Writer.WriteHeader(code)
+}
+
+// JSONStatus writes a JSON response with the provided status code and data.
+func (ctx *ContextHandler) JSONStatus(code int, data interface{}) {
+	ctx.Status(code)
+	ctx.JSON(data)
+}
+
+// NoContent writes a 204 No Content response without a body.
+func (ctx *ContextHandler) NoContent() {
+	ctx.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// Created writes a 201 Created response with the Location header set to location.
+// The data is written as JSON unless it is nil.
+func (ctx *ContextHandler) Created(location string, data interface{}) {
+	if location != "" {
+		ctx.Writer.Header().Set("Location", location)
+	}
+	if data == nil {
+		ctx.Writer.WriteHeader(http.StatusCreated)
+		return
+	}
+	ctx.JSONStatus(http.StatusCreated, data)
+}
+
+// Redirect replies to the request with a redirect to url, which may be a path relative to the request path.
+// The code should be a 3xx status such as http.StatusFound or http.StatusSeeOther.
+func (ctx *ContextHandler) Redirect(code int, url string) {
+	http.Redirect(ctx.Writer, ctx.Request, url, code)
+}
+
+// String writes a text/plain response with the provided status code, formatting the arguments as fmt.Sprintf does.
+func (ctx *ContextHandler) String(code int, format string, args ...interface{}) {
+	ctx.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	ctx.Writer.WriteHeader(code)
+	if len(args) > 0 {
+		fmt.Fprintf(ctx.Writer, format, args...)
+		return
+	}
+	ctx.Writer.Write([]byte(format))
+}
+
+// HTML writes a text/html response with the provided status code and markup.
+func (ctx *ContextHandler) HTML(code int, html string) {
+	ctx.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Writer.WriteHeader(code)
+	ctx.Writer.Write([]byte(html))
+}
+
+// Blob writes a response with the provided status code, content type and raw data.
+func (ctx *ContextHandler) Blob(code int, contentType string, data []byte) {
+	ctx.Writer.Header().Set("Content-Type", contentType)
+	ctx.Writer.WriteHeader(code)
+	ctx.Writer.Write(data)
+}
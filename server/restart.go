@@ -0,0 +1,363 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultRestartTimeout is how long a graceful restart waits for the new process to be ready.
+const DefaultRestartTimeout = 30 * time.Second
+
+// restartSettleTimeout bounds how long a graceful restart waits, once this process stopped accepting
+// connections, for those it already accepted to send their first request. http.Server.Shutdown closes
+// a connection whose request is read after it started, without a response.
+const restartSettleTimeout = time.Second
+
+// ErrRestartInProgress is returned when a graceful restart is requested while another one, or a shutdown, is running.
+var ErrRestartInProgress = errors.New("restart or shutdown already in progress")
+
+// Environment variables describing the sockets handed over to the new process by a graceful restart.
+const (
+	restartFDsEnv   = "SERVERBASE_LISTEN_FDS"
+	restartNamesEnv = "SERVERBASE_LISTEN_FDNAMES"
+	restartReadyEnv = "SERVERBASE_READY_FD"
+)
+
+// Names of the sockets handed over, telling the server listeners from the HTTPS redirect listener.
+const (
+	restartServerName   = "server"
+	restartRedirectName = "redirect"
+)
+
+// Restart upgrades the server without refusing connections: it starts the current executable again with the
+// same arguments, hands it the listening sockets, waits up to RestartTimeout for the new process to serve,
+// stops accepting connections on the sockets, then stops this server gracefully with Stop. Connections are
+// accepted by one process or the other the whole time, and those accepted by this one are served.
+// When the new process fails to start, or is not ready in time, it is killed and this server keeps serving.
+//
+// Run calls Restart when one of the RestartSignals is received and GracefulRestart is set. Listeners provided
+// by the caller through Listeners are not handed over; the new process must open them itself.
+func (api *MyAPIServer) Restart() error {
+	if err := api.handOver(); err != nil {
+		return err
+	}
+	return api.Stop(context.Background())
+}
+
+// handOver starts the new process with the listening sockets and waits for it to be ready.
+func (api *MyAPIServer) handOver() error {
+	api.lifecycleMu.Lock()
+	if api.httpServer == nil {
+		api.lifecycleMu.Unlock()
+		return ErrServerNotStarted
+	}
+	if api.stopping || api.restarting {
+		api.lifecycleMu.Unlock()
+		return ErrRestartInProgress
+	}
+	api.restarting = true
+	listeners := api.ownListeners()
+	redirectListener := api.redirectListener
+	api.lifecycleMu.Unlock()
+
+	err := api.startNewProcess(listeners, redirectListener)
+
+	api.lifecycleMu.Lock()
+	api.restarting = false
+	var handOffs []*handOffListener
+	if err == nil {
+		// The sockets belong to the new process now: closing them here must not remove their files
+		for _, listener := range append(listeners, redirectListener) {
+			if unixListener, ok := listener.(*net.UnixListener); ok {
+				unixListener.SetUnlinkOnClose(false)
+			}
+		}
+		for _, handOff := range api.handOffs {
+			for _, listener := range listeners {
+				if handOff.Listener == listener {
+					handOffs = append(handOffs, handOff)
+				}
+			}
+		}
+	}
+	api.lifecycleMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Leave the new connections to the new process, and let those accepted here be read before draining
+	deadline := time.Now().Add(restartSettleTimeout)
+	for _, handOff := range handOffs {
+		handOff.stopAccepting(deadline)
+	}
+	api.pendingConns.wait(deadline)
+	return nil
+}
+
+// ownListeners returns the listeners opened by the server, leaving out those provided through Listeners.
+// api.lifecycleMu must be held.
+func (api *MyAPIServer) ownListeners() []net.Listener {
+	var listeners []net.Listener
+	for _, listener := range api.listeners {
+		provided := false
+		for _, l := range api.Listeners {
+			if l == listener {
+				provided = true
+				break
+			}
+		}
+		if !provided {
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners
+}
+
+// startNewProcess starts the current executable with the listeners and the redirect listener, if any,
+// and waits for it to report being ready on a pipe.
+func (api *MyAPIServer) startNewProcess(listeners []net.Listener, redirectListener net.Listener) error {
+	var fds []uintptr
+	var names []string
+	addFD := func(listener net.Listener, name string) error {
+		fd, err := listenerFD(listener)
+		if err != nil {
+			return err
+		}
+		fds = append(fds, fd)
+		names = append(names, name)
+		return nil
+	}
+	for _, listener := range listeners {
+		if err := addFD(listener, restartServerName); err != nil {
+			return err
+		}
+	}
+	if redirectListener != nil {
+		if err := addFD(redirectListener, restartRedirectName); err != nil {
+			return err
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+	readyFD, err := rawFD(readyWriter)
+	if err != nil {
+		readyWriter.Close()
+		return err
+	}
+
+	// The sockets become the descriptors 3 to 3+n-1 of the new process, followed by the readiness pipe
+	env := append(os.Environ(),
+		restartFDsEnv+"="+strconv.Itoa(len(fds)),
+		restartNamesEnv+"="+strings.Join(names, ":"),
+		restartReadyEnv+"="+strconv.Itoa(listenFDsStart+len(fds)),
+	)
+	process, err := startProcess(executable, os.Args, env, append(fds, readyFD))
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("starting new process: %w", err)
+	}
+	api.Logger.Printf("Started new process %d, waiting for it to be ready", process.Pid)
+
+	// The pipe reaches end of file without a byte if the new process exits before being ready
+	readyReader.SetReadDeadline(time.Now().Add(api.RestartTimeout))
+	if _, err = readyReader.Read(make([]byte, 1)); err != nil {
+		process.Kill()
+		process.Wait()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("new process %d exited before it was ready", process.Pid)
+		}
+		return fmt.Errorf("new process %d not ready: %w", process.Pid, err)
+	}
+	api.Logger.Printf("New process %d is ready, stopping this one", process.Pid)
+	return process.Release()
+}
+
+// listenerFD returns the descriptor of the socket of the listener, such as a *net.TCPListener or *net.UnixListener.
+func listenerFD(listener net.Listener) (uintptr, error) {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("cannot hand over listener %v of type %T", listener.Addr(), listener)
+	}
+	return rawFD(conn)
+}
+
+// rawFD returns the descriptor of the connection without changing its mode: os.File.Fd, used by os/exec
+// for ExtraFiles, switches a socket to blocking mode for every process sharing it, which would leave
+// Accept of this server blocked in a system call that closing the listener cannot interrupt.
+func rawFD(conn syscall.Conn) (uintptr, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd uintptr
+	if err = rawConn.Control(func(f uintptr) { fd = f }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// inheritListeners takes the sockets handed over by the process that started this one for a graceful restart.
+// The server listeners are returned; the redirect listener and the readiness pipe are kept for startServer.
+// It returns no listeners when the process was not started by a graceful restart. The environment variables
+// are removed so that later restarts and other child processes do not inherit them.
+func (api *MyAPIServer) inheritListeners() ([]net.Listener, error) {
+	count := os.Getenv(restartFDsEnv)
+	if count == "" {
+		return nil, nil
+	}
+	names := os.Getenv(restartNamesEnv)
+	readyFD, err := strconv.Atoi(os.Getenv(restartReadyEnv))
+	os.Unsetenv(restartFDsEnv)
+	os.Unsetenv(restartNamesEnv)
+	os.Unsetenv(restartReadyEnv)
+	if err == nil {
+		api.restartReady = os.NewFile(uintptr(readyFD), "ready")
+	}
+
+	inherited, err := fileListeners(count, names)
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for i, name := range strings.Split(names, ":") {
+		if i >= len(inherited) {
+			break
+		}
+		if name == restartRedirectName {
+			api.redirectListener = inherited[i]
+		} else {
+			listeners = append(listeners, inherited[i])
+		}
+	}
+	return listeners, nil
+}
+
+// notifyRestarted tells the process that started this one for a graceful restart that the server is ready.
+func (api *MyAPIServer) notifyRestarted() {
+	if api.restartReady == nil {
+		return
+	}
+	if _, err := api.restartReady.Write([]byte{1}); err != nil {
+		api.Logger.Printf("Error reporting readiness to the previous process: %v", err)
+	}
+	api.restartReady.Close()
+	api.restartReady = nil
+}
+
+// handOffListener is a server listener that a graceful restart can stop accepting connections, leaving them
+// to the new process, without closing the socket it shares with that process. Once stopped, Accept waits for
+// the server to close the listener.
+type handOffListener struct {
+	net.Listener
+	stop      chan struct{}
+	stopOnce  sync.Once
+	parked    chan struct{}
+	parkOnce  sync.Once
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newHandOffListener(listener net.Listener) *handOffListener {
+	return &handOffListener{
+		Listener: listener,
+		stop:     make(chan struct{}),
+		parked:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (l *handOffListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		return conn, nil
+	}
+	select {
+	case <-l.stop:
+	default:
+		return nil, err
+	}
+	// Stopped by stopAccepting, which interrupted the accept with a deadline
+	l.parkOnce.Do(func() { close(l.parked) })
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *handOffListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// stopAccepting interrupts the pending accept and waits, until the deadline, for the server to be back
+// in Accept: a connection accepted until then has been passed to the server.
+func (l *handOffListener) stopAccepting(deadline time.Time) {
+	listener, ok := l.Listener.(interface{ SetDeadline(time.Time) error })
+	if !ok {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+	if err := listener.SetDeadline(time.Unix(1, 0)); err != nil {
+		return
+	}
+	select {
+	case <-l.parked:
+	case <-l.closed:
+	case <-time.After(time.Until(deadline)):
+	}
+}
+
+// pendingConns tracks the connections accepted but whose first request is not read yet.
+type pendingConns struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// track records the connection while it is in the http.StateNew state.
+func (p *pendingConns) track(conn net.Conn, state http.ConnState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state != http.StateNew {
+		delete(p.conns, conn)
+		return
+	}
+	if p.conns == nil {
+		p.conns = make(map[net.Conn]struct{})
+	}
+	p.conns[conn] = struct{}{}
+}
+
+// wait waits until no connection is pending or the deadline is reached.
+func (p *pendingConns) wait(deadline time.Time) {
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		pending := len(p.conns)
+		p.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// DefaultRestartSignals are the signals triggering a graceful restart when GracefulRestart is set.
+// Graceful restarts rely on passing sockets to a child process, which this platform does not support.
+var DefaultRestartSignals []os.Signal
+
+// startProcess reports that passing sockets to a new process is not supported on this platform.
+func startProcess(executable string, args []string, env []string, fds []uintptr) (*os.Process, error) {
+	return nil, errors.New("graceful restart is not supported on this platform")
+}
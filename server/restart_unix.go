@@ -0,0 +1,28 @@
+//go:build unix
+
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// DefaultRestartSignals are the signals triggering a graceful restart when GracefulRestart is set.
+var DefaultRestartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// startProcess starts the executable with the descriptors as its descriptors 3 and up, after the
+// standard input, output and error of this process.
+func startProcess(executable string, args []string, env []string, fds []uintptr) (*os.Process, error) {
+	files := append([]uintptr{uintptr(syscall.Stdin), uintptr(syscall.Stdout), uintptr(syscall.Stderr)}, fds...)
+	pid, err := syscall.ForkExec(executable, args, &syscall.ProcAttr{Env: env, Files: files})
+	if err != nil {
+		return nil, err
+	}
+	return os.FindProcess(pid)
+}
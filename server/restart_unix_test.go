@@ -0,0 +1,190 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// restartChildEnv tells the new process started by the restart tests how to behave: "ok", "fail" or "hang".
+const restartChildEnv = "SERVER_TEST_RESTART_CHILD"
+
+// runRestartChild runs the new process of a graceful restart. It reports whether the test runs as such.
+func runRestartChild(t *testing.T) bool {
+	if os.Getenv(restartFDsEnv) == "" {
+		return false
+	}
+	switch os.Getenv(restartChildEnv) {
+	case "fail":
+		// Exit before reporting readiness
+		return true
+	case "hang":
+		time.Sleep(time.Minute)
+		return true
+	}
+
+	api := newTestServer(t, nil)
+	api.Get("/who", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("new")) })
+	api.Get("/quit", func(w http.ResponseWriter, r *http.Request) {
+		go api.Stop(context.Background())
+	})
+	if err := api.Start(); err != nil {
+		t.Fatalf("new process: Start: %v", err)
+	}
+	select {
+	case <-api.Done():
+	case <-time.After(30 * time.Second):
+		t.Error("new process not stopped")
+	}
+	return true
+}
+
+// restartArgs makes the new process run only the test, whatever the arguments of this process.
+func restartArgs(t *testing.T) {
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^" + t.Name() + "$"}
+	t.Cleanup(func() { os.Args = args })
+}
+
+func TestRestartHandOver(t *testing.T) {
+	if runRestartChild(t) {
+		return
+	}
+	restartArgs(t)
+	t.Setenv(restartChildEnv, "ok")
+
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+
+	api := newTestServer(t, &OptionalParams{Addrs: []string{"unix:" + socket}})
+	api.Get("/who", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("old")) })
+	slowStarted := make(chan struct{})
+	api.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(slowStarted)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("old done"))
+	})
+	if err := api.Start(); err != nil {
+		t.Fatal(err)
+	}
+	baseURL := "http://" + api.ListenAddr().String()
+
+	// A request in flight during the restart is completed by the old process
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if body := getBody(t, http.DefaultClient, baseURL+"/slow"); body != "old done" {
+			t.Errorf("in-flight request = %q", body)
+		}
+	}()
+	<-slowStarted
+
+	// Connections are accepted by one process or the other the whole time
+	var failures atomic.Int32
+	var lastErr atomic.Value
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			resp, err := client.Get(baseURL + "/who")
+			if err != nil {
+				failures.Add(1)
+				lastErr.Store(err)
+				continue
+			}
+			resp.Body.Close()
+		}
+	}()
+
+	if err := api.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+	if n := failures.Load(); n > 0 {
+		t.Errorf("%d requests failed during the restart, last: %v", n, lastErr.Load())
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	if body := getBody(t, client, baseURL+"/who"); body != "new" {
+		t.Errorf("after Restart, GET /who = %q, want the new process", body)
+	}
+	// The socket file is kept for the new process
+	if body := getBody(t, unixClient(socket), "http://unix/who"); body != "new" {
+		t.Errorf("after Restart, GET /who over the socket = %q, want the new process", body)
+	}
+	getBody(t, client, baseURL+"/quit")
+}
+
+func TestRestartFailure(t *testing.T) {
+	if runRestartChild(t) {
+		return
+	}
+	restartArgs(t)
+	tests := []struct {
+		mode    string
+		timeout time.Duration
+		wantErr string
+	}{
+		{mode: "fail", timeout: 30 * time.Second, wantErr: "exited before it was ready"},
+		{mode: "hang", timeout: 500 * time.Millisecond, wantErr: "not ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv(restartChildEnv, tt.mode)
+			api := newTestServer(t, &OptionalParams{RestartTimeout: tt.timeout})
+			api.Get("/who", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("old")) })
+			baseURL := startTestServer(t, api)
+
+			if err := api.Restart(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Restart = %v, want %q", err, tt.wantErr)
+			}
+			// The server keeps serving after a failed restart
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			if body := getBody(t, client, baseURL+"/who"); body != "old" {
+				t.Errorf("GET /who = %q, want the old process", body)
+			}
+			if !api.Ready() {
+				t.Error("not ready after a failed restart")
+			}
+		})
+	}
+}
+
+func TestRestartState(t *testing.T) {
+	api := newTestServer(t, nil)
+	if err := api.Restart(); !errors.Is(err, ErrServerNotStarted) {
+		t.Errorf("Restart before Start = %v, want ErrServerNotStarted", err)
+	}
+	startTestServer(t, api)
+	api.lifecycleMu.Lock()
+	api.stopping = true
+	api.lifecycleMu.Unlock()
+	if err := api.Restart(); !errors.Is(err, ErrRestartInProgress) {
+		t.Errorf("Restart while stopping = %v, want ErrRestartInProgress", err)
+	}
+	api.lifecycleMu.Lock()
+	api.stopping = false
+	api.lifecycleMu.Unlock()
+}
@@ -0,0 +1,242 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteGroup represents a set of routes sharing a URL prefix and a middleware stack.
+// Middleware added to a group only applies to the routes registered through that group
+// and its nested groups. For a request, middleware runs in the following order:
+// server middleware (AddMiddleware / AddMiddlewareN), group middleware from the outermost
+// group inwards, route middleware passed at registration, and finally the handler.
+type RouteGroup struct {
+	// api is the server the group registers its routes on.
+	api *MyAPIServer
+
+	// prefix is the URL prefix prepended to every route of the group.
+	prefix string
+
+	// middlewares contains the middleware functions applied to the group's routes, outermost first.
+	middlewares []MiddlewareConvertedN
+}
+
+// Group creates a new route group with the given prefix and standard middleware functions.
+func (api *MyAPIServer) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	group := &RouteGroup{api: api, prefix: joinPrefix("", prefix)}
+	group.Use(middlewares...)
+	return group
+}
+
+// GroupN creates a new route group with the given prefix and ContextHandler middleware functions.
+func (api *MyAPIServer) GroupN(prefix string, middlewares ...MiddlewareN) *RouteGroup {
+	group := &RouteGroup{api: api, prefix: joinPrefix("", prefix)}
+	group.UseN(middlewares...)
+	return group
+}
+
+// Group creates a nested route group that inherits the prefix and middleware of the parent group.
+func (g *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	group := g.child(prefix)
+	group.Use(middlewares...)
+	return group
+}
+
+// GroupN creates a nested route group that inherits the prefix and middleware of the parent group.
+func (g *RouteGroup) GroupN(prefix string, middlewares ...MiddlewareN) *RouteGroup {
+	group := g.child(prefix)
+	group.UseN(middlewares...)
+	return group
+}
+
+// Prefix returns the full URL prefix of the group.
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// Use adds standard middleware functions to the group.
+// They only apply to routes registered on the group after the call.
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, convertMiddlewares(middlewares)...)
+}
+
+// UseN adds ContextHandler middleware functions to the group.
+// They only apply to routes registered on the group after the call.
+func (g *RouteGroup) UseN(middlewares ...MiddlewareN) {
+	g.middlewares = append(g.middlewares, g.api.convertMiddlewaresN(middlewares)...)
+}
+
+// Get registers a handler function for the GET method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Get(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodGet, pattern, myHandler, middlewares)
+}
+
+// Post registers a handler function for the POST method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Post(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodPost, pattern, myHandler, middlewares)
+}
+
+// Put registers a handler function for the PUT method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Put(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodPut, pattern, myHandler, middlewares)
+}
+
+// Delete registers a handler function for the DELETE method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Delete(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodDelete, pattern, myHandler, middlewares)
+}
+
+// GetN registers a ContextHandler function for the GET method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) GetN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodGet, pattern, myHandler, middlewares)
+}
+
+// PostN registers a ContextHandler function for the POST method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) PostN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodPost, pattern, myHandler, middlewares)
+}
+
+// PutN registers a ContextHandler function for the PUT method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) PutN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodPut, pattern, myHandler, middlewares)
+}
+
+// DeleteN registers a ContextHandler function for the DELETE method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) DeleteN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodDelete, pattern, myHandler, middlewares)
+}
+
+// Patch registers a handler function for the PATCH method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Patch(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodPatch, pattern, myHandler, middlewares)
+}
+
+// Head registers a handler function for the HEAD method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Head(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodHead, pattern, myHandler, middlewares)
+}
+
+// Options registers a handler function for the OPTIONS method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Options(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodOptions, pattern, myHandler, middlewares)
+}
+
+// Connect registers a handler function for the CONNECT method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Connect(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodConnect, pattern, myHandler, middlewares)
+}
+
+// Trace registers a handler function for the TRACE method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Trace(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.handle(http.MethodTrace, pattern, myHandler, middlewares)
+}
+
+// Any registers a handler function for every standard HTTP method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Any(pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	g.Match(AnyMethods, pattern, myHandler, middlewares...)
+}
+
+// Match registers a handler function for each of the given HTTP methods with the group prefix and the specified URL pattern.
+func (g *RouteGroup) Match(methods []string, pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares ...Middleware) {
+	if len(methods) == 0 {
+		g.api.configError(&ConfigError{Source: "Match", Pattern: joinPrefix(g.prefix, pattern), Err: ErrNoMethods})
+		return
+	}
+	for _, method := range methods {
+		g.handle(method, pattern, myHandler, middlewares)
+	}
+}
+
+// PatchN registers a ContextHandler function for the PATCH method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) PatchN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodPatch, pattern, myHandler, middlewares)
+}
+
+// HeadN registers a ContextHandler function for the HEAD method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) HeadN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodHead, pattern, myHandler, middlewares)
+}
+
+// OptionsN registers a ContextHandler function for the OPTIONS method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) OptionsN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodOptions, pattern, myHandler, middlewares)
+}
+
+// ConnectN registers a ContextHandler function for the CONNECT method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) ConnectN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodConnect, pattern, myHandler, middlewares)
+}
+
+// TraceN registers a ContextHandler function for the TRACE method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) TraceN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.handleN(http.MethodTrace, pattern, myHandler, middlewares)
+}
+
+// AnyN registers a ContextHandler function for every standard HTTP method with the group prefix and the specified URL pattern.
+func (g *RouteGroup) AnyN(pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	g.MatchN(AnyMethods, pattern, myHandler, middlewares...)
+}
+
+// MatchN registers a ContextHandler function for each of the given HTTP methods with the group prefix and the specified URL pattern.
+func (g *RouteGroup) MatchN(methods []string, pattern string, myHandler func(ctx ContextHandler), middlewares ...MiddlewareN) {
+	if len(methods) == 0 {
+		g.api.configError(&ConfigError{Source: "MatchN", Pattern: joinPrefix(g.prefix, pattern), Err: ErrNoMethods})
+		return
+	}
+	for _, method := range methods {
+		g.handleN(method, pattern, myHandler, middlewares)
+	}
+}
+
+// WebSocket registers a WebSocket endpoint with the group prefix and the specified URL pattern.
+func (g *RouteGroup) WebSocket(pattern string, myHandler func(conn *WSConn), middlewares ...Middleware) {
+	g.register(http.MethodGet, pattern, g.api.websocketHandler(myHandler), convertMiddlewares(middlewares))
+}
+
+// WebSocketN registers a WebSocket endpoint with the group prefix and the specified URL pattern, with ContextHandler middlewares.
+func (g *RouteGroup) WebSocketN(pattern string, myHandler func(conn *WSConn), middlewares ...MiddlewareN) {
+	g.register(http.MethodGet, pattern, g.api.websocketHandler(myHandler), g.api.convertMiddlewaresN(middlewares))
+}
+
+// handle registers a standard handler function on the server, applying the group middleware.
+func (g *RouteGroup) handle(method string, pattern string, myHandler func(http.ResponseWriter, *http.Request), middlewares []Middleware) {
+	g.register(method, pattern, http.HandlerFunc(myHandler), convertMiddlewares(middlewares))
+}
+
+// handleN registers a ContextHandler function on the server, applying the group middleware.
+func (g *RouteGroup) handleN(method string, pattern string, myHandler func(ctx ContextHandler), middlewares []MiddlewareN) {
+	g.register(method, pattern, g.api.handlerWrapper(myHandler), g.api.convertMiddlewaresN(middlewares))
+}
+
+// register registers the handler on the server with the group middleware followed by the route middleware.
+func (g *RouteGroup) register(method string, pattern string, handler http.Handler, middlewares []MiddlewareConvertedN) {
+	chain := make([]MiddlewareConvertedN, 0, len(g.middlewares)+len(middlewares))
+	chain = append(chain, g.middlewares...)
+	chain = append(chain, middlewares...)
+	g.api.register(method, joinPrefix(g.prefix, pattern), handler, chain)
+}
+
+// child creates a nested group carrying a copy of the parent middleware.
+func (g *RouteGroup) child(prefix string) *RouteGroup {
+	middlewares := make([]MiddlewareConvertedN, len(g.middlewares))
+	copy(middlewares, g.middlewares)
+	return &RouteGroup{api: g.api, prefix: joinPrefix(g.prefix, prefix), middlewares: middlewares}
+}
+
+// joinPrefix joins a group prefix and a URL pattern, ensuring exactly one slash between them.
+func joinPrefix(prefix string, pattern string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if pattern == "" {
+		return prefix
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	return prefix + pattern
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteGroups(t *testing.T) {
+	var order []string
+	markN := func(name string) MiddlewareN {
+		return func(ctx ContextHandler) { order = append(order, name) }
+	}
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			}
+		}
+	}
+	handlerN := func(ctx ContextHandler) { order = append(order, "handler") }
+	handler := func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }
+
+	api := newTestServer(t, nil)
+	api.AddMiddlewareN(markN("server"))
+	admin := api.GroupN("/admin", markN("admin"))
+	admin.GetN("/users", handlerN)
+	reports := admin.Group("reports/", mark("reports"))
+	reports.Get("/daily", handler, mark("route"))
+	// Added after the nested group was created: only applies to the routes registered next on the group
+	admin.UseN(markN("late"))
+	admin.DeleteN("/users/{id}", handlerN)
+	public := api.Group("/public")
+	public.Get("/status", handler)
+	api.Get("/root", handler)
+
+	if got := reports.Prefix(); got != "/admin/reports/" {
+		t.Errorf("Prefix = %q, want /admin/reports/", got)
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantOrder  string
+	}{
+		{http.MethodGet, "/admin/users", http.StatusOK, "server, admin, handler"},
+		{http.MethodGet, "/admin/reports/daily", http.StatusOK, "server, admin, reports, route, handler"},
+		{http.MethodDelete, "/admin/users/7", http.StatusOK, "server, admin, late, handler"},
+		{http.MethodGet, "/public/status", http.StatusOK, "server, handler"},
+		{http.MethodGet, "/root", http.StatusOK, "server, handler"},
+		{http.MethodGet, "/admin/missing", http.StatusNotFound, "server"},
+	}
+	handlerRoot := api.ServMConfigure(nil)
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			order = nil
+			w := httptest.NewRecorder()
+			handlerRoot.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.Join(order, ", "); got != tt.wantOrder {
+				t.Errorf("order = %s, want %s", got, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestJoinPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		pattern string
+		want    string
+	}{
+		{"", "/users", "/users"},
+		{"/api", "/users", "/api/users"},
+		{"/api/", "/users", "/api/users"},
+		{"/api", "users", "/api/users"},
+		{"/api", "", "/api"},
+		{"/api", "/", "/api/"},
+		{"/api", "/{$}", "/api/{$}"},
+	}
+	for _, tt := range tests {
+		if got := joinPrefix(tt.prefix, tt.pattern); got != tt.want {
+			t.Errorf("joinPrefix(%q, %q) = %q, want %q", tt.prefix, tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AnyMethods is the list of HTTP methods registered by Any and AnyN.
+var AnyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+// Route describes a route registered on the server.
+type Route struct {
+	// Method is the HTTP method of the route.
+	Method string
+
+	// Pattern is the URL pattern of the route, including any group prefix.
+	Pattern string
+}
+
+// Routes returns the routes registered on the server in registration order.
+func (api *MyAPIServer) Routes() []Route {
+	routes := make([]Route, len(api.Serv.Routes))
+	copy(routes, api.Serv.Routes)
+	return routes
+}
+
+// allowedMethods returns the methods registered for the given pattern, or for patterns of the same shape,
+// in the order used by the Allow header.
+// GET routes also allow HEAD, as the ServeMux serves HEAD requests with the GET handler,
+// and OPTIONS is always allowed since it is answered automatically.
+func (api *MyAPIServer) allowedMethods(pattern string) []string {
+	shape := patternShape(pattern)
+	registered := map[string]bool{http.MethodOptions: true}
+	for _, route := range api.Serv.Routes {
+		if patternShape(route.Pattern) == shape {
+			registered[route.Method] = true
+		}
+	}
+	if registered[http.MethodGet] {
+		registered[http.MethodHead] = true
+	}
+
+	var allowed []string
+	// Standard methods first, in a fixed order
+	for _, method := range AnyMethods {
+		if registered[method] {
+			allowed = append(allowed, method)
+			delete(registered, method)
+		}
+	}
+	// Followed by any extension methods in registration order
+	for _, route := range api.Serv.Routes {
+		if registered[route.Method] && patternShape(route.Pattern) == shape {
+			allowed = append(allowed, route.Method)
+			delete(registered, route.Method)
+		}
+	}
+	return allowed
+}
+
+// registerAutoOptions registers an OPTIONS handler answering with the Allow header
+// for every pattern shape that has no OPTIONS route of its own.
+func (api *MyAPIServer) registerAutoOptions() {
+	if api.Serv.autoOptions == nil {
+		api.Serv.autoOptions = make(map[string]bool)
+	}
+	for _, pattern := range api.autoOptionsPatterns() {
+		shape := patternShape(pattern)
+		if api.Serv.autoOptions[shape] {
+			continue
+		}
+		api.Serv.autoOptions[shape] = true
+		api.handleMux(http.MethodOptions, pattern, api.autoOptionsHandler(pattern))
+	}
+}
+
+// autoOptionsHandler returns the handler answering OPTIONS requests for the pattern.
+func (api *MyAPIServer) autoOptionsHandler(pattern string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(api.allowedMethods(pattern), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// autoOptionsPatterns returns the patterns needing an automatic OPTIONS handler, one per pattern shape:
+// patterns differing only by their wildcard names, such as /users/{id} and /users/{name}, match the
+// same requests and would conflict as OPTIONS routes.
+func (api *MyAPIServer) autoOptionsPatterns() []string {
+	hasOptions := make(map[string]bool)
+	for _, route := range api.Serv.Routes {
+		if route.Method == http.MethodOptions {
+			hasOptions[patternShape(route.Pattern)] = true
+		}
+	}
+	var patterns []string
+	for _, route := range api.Serv.Routes {
+		shape := patternShape(route.Pattern)
+		if hasOptions[shape] {
+			continue
+		}
+		hasOptions[shape] = true
+		patterns = append(patterns, route.Pattern)
+	}
+	return patterns
+}
+
+// checkAutoOptions returns the automatic OPTIONS handlers that cannot be registered, such as OPTIONS /a/{x}
+// and OPTIONS /{y}/b, which match the same requests without one being more specific. They are registered
+// on a scratch ServeMux along with the OPTIONS routes, the only ones they can conflict with.
+func (api *MyAPIServer) checkAutoOptions() ConfigErrors {
+	mux := http.NewServeMux()
+	for _, route := range api.Serv.Routes {
+		if route.Method == http.MethodOptions {
+			// Conflicts between routes were reported when they were registered
+			handle(mux, route.Method, route.Pattern, http.NotFoundHandler())
+		}
+	}
+	var errs ConfigErrors
+	for _, pattern := range api.autoOptionsPatterns() {
+		if err := handle(mux, http.MethodOptions, pattern, http.NotFoundHandler()); err != nil {
+			errs = append(errs, &ConfigError{Source: "auto OPTIONS", Method: http.MethodOptions, Pattern: pattern, Err: err})
+		}
+	}
+	return errs
+}
+
+// patternShape returns the pattern without its wildcard names, e.g. /users/{} for /users/{id}.
+func patternShape(pattern string) string {
+	var shape strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if start < 0 || end < start {
+			break
+		}
+		shape.WriteString(pattern[:start])
+		switch name := pattern[start+1 : end]; {
+		case name == "$":
+			shape.WriteString("{$}")
+		case strings.HasSuffix(name, "..."):
+			shape.WriteString("{...}")
+		default:
+			shape.WriteString("{}")
+		}
+		pattern = pattern[end+1:]
+	}
+	shape.WriteString(pattern)
+	return shape.String()
+}
+
+// NotFound sets the handler called for requests matching no route.
+// The response status defaults to 404 unless the handler writes another one.
+// The server middleware runs before the handler, as for any route.
+func (api *MyAPIServer) NotFound(myHandler func(http.ResponseWriter, *http.Request)) {
+	api.Serv.NotFoundHandler = nil
+	if myHandler != nil {
+		api.Serv.NotFoundHandler = http.HandlerFunc(myHandler)
+	}
+}
+
+// NotFoundN sets the ContextHandler function called for requests matching no route.
+// The response status defaults to 404 unless the handler writes another one.
+// The server middleware runs before the handler, as for any route.
+func (api *MyAPIServer) NotFoundN(myHandler func(ctx ContextHandler)) {
+	api.Serv.NotFoundHandler = nil
+	if myHandler != nil {
+		api.Serv.NotFoundHandler = api.handlerWrapper(myHandler)
+	}
+}
+
+// MethodNotAllowed sets the handler called for requests whose path matches routes of other methods only.
+// The Allow header listing those methods is set before the handler is called, and the response
+// status defaults to 405 unless the handler writes another one.
+// The server middleware runs before the handler, as for any route.
+func (api *MyAPIServer) MethodNotAllowed(myHandler func(http.ResponseWriter, *http.Request)) {
+	api.Serv.MethodNotAllowedHandler = nil
+	if myHandler != nil {
+		api.Serv.MethodNotAllowedHandler = http.HandlerFunc(myHandler)
+	}
+}
+
+// MethodNotAllowedN sets the ContextHandler function called for requests whose path matches routes
+// of other methods only. The Allow header listing those methods is set before the handler is called,
+// and the response status defaults to 405 unless the handler writes another one.
+// The server middleware runs before the handler, as for any route.
+func (api *MyAPIServer) MethodNotAllowedN(myHandler func(ctx ContextHandler)) {
+	api.Serv.MethodNotAllowedHandler = nil
+	if myHandler != nil {
+		api.Serv.MethodNotAllowedHandler = api.handlerWrapper(myHandler)
+	}
+}
+
+// routeHandler serves the requests with the mux and handles unmatched requests:
+// with 404 Not Found when no route matches the path, and with 405 Method Not Allowed and the
+// Allow header when routes match the path for other methods only. Unmatched requests are passed
+// to the NotFound and MethodNotAllowed hooks when set, and to the error renderer otherwise.
+func (api *MyAPIServer) routeHandler(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed := api.matchingMethods(mux, r); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			if api.Serv.MethodNotAllowedHandler != nil {
+				serveFallback(api.Serv.MethodNotAllowedHandler, w, r, http.StatusMethodNotAllowed)
+				return
+			}
+			ctx := api.newContextHandler(w, r)
+			ctx.Error(NewHTTPError(http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", r.Method)))
+			return
+		}
+
+		if api.Serv.NotFoundHandler != nil {
+			serveFallback(api.Serv.NotFoundHandler, w, r, http.StatusNotFound)
+			return
+		}
+		ctx := api.newContextHandler(w, r)
+		ctx.Error(NewHTTPError(http.StatusNotFound, fmt.Sprintf("no route matches %s", r.URL.Path)))
+	})
+}
+
+// matchingMethods returns the methods for which the mux has a route matching the request path.
+func (api *MyAPIServer) matchingMethods(mux *http.ServeMux, r *http.Request) []string {
+	methods := append([]string{}, AnyMethods...)
+	for _, route := range api.Serv.Routes {
+		methods = append(methods, route.Method)
+	}
+
+	var allowed []string
+	seen := make(map[string]bool)
+	for _, method := range methods {
+		if seen[method] || method == r.Method {
+			continue
+		}
+		seen[method] = true
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// serveFallback serves the request with the handler, using status as the default response status.
+func serveFallback(handler http.Handler, w http.ResponseWriter, r *http.Request, status int) {
+	rw := wrapResponseWriter(w)
+	if defaultWriter, ok := rw.(*responseWriter); ok && defaultWriter.pending == 0 {
+		defaultWriter.pending = status
+	}
+	handler.ServeHTTP(rw, r)
+	if !rw.Written() {
+		rw.WriteHeader(status)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAutoOptions(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		name      string
+		register  func(api *MyAPIServer)
+		path      string
+		wantAllow string
+		wantErr   error
+	}{
+		{
+			name: "single pattern",
+			register: func(api *MyAPIServer) {
+				api.Get("/users", noop)
+				api.Post("/users", noop)
+			},
+			path:      "/users",
+			wantAllow: "GET, HEAD, POST, OPTIONS",
+		},
+		{
+			name: "wildcard names differ",
+			register: func(api *MyAPIServer) {
+				api.Get("/users/{id}", noop)
+				api.Post("/users/{name}", noop)
+				api.Delete("/users/{key}", noop)
+			},
+			path:      "/users/42",
+			wantAllow: "GET, HEAD, POST, DELETE, OPTIONS",
+		},
+		{
+			name: "explicit OPTIONS route of the same shape",
+			register: func(api *MyAPIServer) {
+				api.Get("/items/{id}", noop)
+				api.Options("/items/{item}", func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Allow", "custom")
+				})
+			},
+			path:      "/items/1",
+			wantAllow: "custom",
+		},
+		{
+			name: "overlapping patterns",
+			register: func(api *MyAPIServer) {
+				api.Get("/a/{x}", noop)
+				api.Post("/{y}/b", noop)
+			},
+			wantErr: ErrPatternConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			tt.register(api)
+			if err := api.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			api.registerAutoOptions()
+			servM := api.ServMConfigure(nil)
+
+			w := httptest.NewRecorder()
+			servM.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, tt.path, nil))
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestPatternShape(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"/users", "/users"},
+		{"/users/{id}", "/users/{}"},
+		{"/users/{id}/posts/{post}", "/users/{}/posts/{}"},
+		{"/files/{path...}", "/files/{...}"},
+		{"/{$}", "/{$}"},
+		{"example.com/{name}", "example.com/{}"},
+	}
+	for _, tt := range tests {
+		if got := patternShape(tt.pattern); got != tt.want {
+			t.Errorf("patternShape(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNotFoundAndMethodNotAllowed(t *testing.T) {
+	tests := []struct {
+		name            string
+		hooks           func(api *MyAPIServer)
+		method          string
+		path            string
+		wantStatus      int
+		wantAllow       string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "default not found",
+			method:          http.MethodGet,
+			path:            "/missing",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody:        `"no route matches /missing"`,
+		},
+		{
+			name:            "default method not allowed",
+			method:          http.MethodPut,
+			path:            "/users/1",
+			wantStatus:      http.StatusMethodNotAllowed,
+			wantAllow:       "GET, HEAD, DELETE",
+			wantContentType: "application/problem+json",
+			wantBody:        `"method PUT is not allowed"`,
+		},
+		{
+			name:       "HEAD of a GET route",
+			method:     http.MethodHead,
+			path:       "/users/1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "NotFound",
+			hooks: func(api *MyAPIServer) {
+				api.NotFound(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("custom " + r.URL.Path)) })
+			},
+			method:     http.MethodGet,
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "custom /missing",
+		},
+		{
+			name: "NotFoundN with another status",
+			hooks: func(api *MyAPIServer) {
+				api.NotFoundN(func(ctx ContextHandler) {
+					ctx.JSONStatus(http.StatusGone, map[string]string{"error": "gone"})
+				})
+			},
+			method:          http.MethodGet,
+			path:            "/missing",
+			wantStatus:      http.StatusGone,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"gone"}`,
+		},
+		{
+			name: "MethodNotAllowed",
+			hooks: func(api *MyAPIServer) {
+				api.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("allowed: " + w.Header().Get("Allow")))
+				})
+			},
+			method:     http.MethodPost,
+			path:       "/users/1",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET, HEAD, DELETE",
+			wantBody:   "allowed: GET, HEAD, DELETE",
+		},
+		{
+			name: "MethodNotAllowedN",
+			hooks: func(api *MyAPIServer) {
+				api.MethodNotAllowedN(func(ctx ContextHandler) {
+					ctx.JSON(map[string]string{"error": "method"})
+				})
+			},
+			method:          http.MethodPatch,
+			path:            "/users",
+			wantStatus:      http.StatusMethodNotAllowed,
+			wantAllow:       "POST",
+			wantContentType: "application/json",
+			wantBody:        `{"error":"method"}`,
+		},
+		{
+			name: "hooks removed",
+			hooks: func(api *MyAPIServer) {
+				api.NotFound(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("custom")) })
+				api.NotFound(nil)
+			},
+			method:          http.MethodGet,
+			path:            "/missing",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			middlewareRan := false
+			api.AddMiddlewareN(func(ctx ContextHandler) {
+				middlewareRan = true
+				ctx.Writer.Header().Set("X-Request-ID", "42")
+			})
+			noop := func(w http.ResponseWriter, r *http.Request) {}
+			api.Get("/users/{id}", noop)
+			api.DeleteN("/users/{id}", func(ctx ContextHandler) {})
+			api.Post("/users", noop)
+			if tt.hooks != nil {
+				tt.hooks(api)
+			}
+
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body, tt.wantBody)
+			}
+			if !middlewareRan || w.Header().Get("X-Request-ID") != "42" {
+				t.Error("server middleware did not run")
+			}
+		})
+	}
+}
+
+func TestNotFoundWithPrefix(t *testing.T) {
+	api := newTestServer(t, nil)
+	api.Get("/users", func(w http.ResponseWriter, r *http.Request) {})
+	api.NotFound(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("not found")) })
+	api.AddPrefix("/api/")
+	handler := api.ServMConfigure(nil)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{http.MethodGet, "/api/users", http.StatusOK, ""},
+		{http.MethodGet, "/api/missing", http.StatusNotFound, ""},
+		{http.MethodPost, "/api/users", http.StatusMethodNotAllowed, "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.wantStatus || w.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s = %d (Allow %q), want %d (Allow %q)", tt.method, tt.path, w.Code, w.Header().Get("Allow"), tt.wantStatus, tt.wantAllow)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server listening on a free loopback port, logging nowhere and collecting
+// configuration errors.
+func newTestServer(t *testing.T, opts *OptionalParams) *MyAPIServer {
+	t.Helper()
+	if opts == nil {
+		opts = &OptionalParams{}
+	}
+	opts.CollectConfigErrors = true
+	if opts.Addr == "" {
+		opts.Addr = "127.0.0.1:0"
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+	return NewMyAPIServer(opts)
+}
+
+// startTestServer starts the server, stops it at the end of the test and returns its base URL.
+func startTestServer(t *testing.T, api *MyAPIServer) string {
+	t.Helper()
+	if err := api.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		api.Stop(ctx)
+	})
+	return "http://" + api.ListenAddr().String()
+}
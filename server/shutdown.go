@@ -0,0 +1,158 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDrainTimeout is how long the server waits for in-flight requests to finish when shutting down.
+const DefaultDrainTimeout = 30 * time.Second
+
+// DefaultShutdownSignals are the signals triggering a graceful shutdown: Ctrl-C and the SIGTERM sent by
+// process managers such as Kubernetes and systemd.
+var DefaultShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// ShutdownHook is a function run while the server shuts down, e.g. to flush queues or close databases.
+// The context ends with the drain timeout.
+type ShutdownHook func(ctx context.Context) error
+
+// InFlightRequest describes a request being handled by the server.
+type InFlightRequest struct {
+	Method     string
+	Path       string
+	RemoteAddr string
+	Started    time.Time
+}
+
+// inFlightRequests tracks the requests being handled by the server.
+type inFlightRequests struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]InFlightRequest
+}
+
+// add records the request and returns its key.
+func (f *inFlightRequests) add(r *http.Request) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.requests == nil {
+		f.requests = make(map[uint64]InFlightRequest)
+	}
+	f.next++
+	f.requests[f.next] = InFlightRequest{Method: r.Method, Path: r.URL.Path, RemoteAddr: r.RemoteAddr, Started: time.Now()}
+	return f.next
+}
+
+// remove forgets the request with the key.
+func (f *inFlightRequests) remove(key uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.requests, key)
+}
+
+// list returns the requests, oldest first.
+func (f *inFlightRequests) list() []InFlightRequest {
+	f.mu.Lock()
+	requests := make([]InFlightRequest, 0, len(f.requests))
+	for _, request := range f.requests {
+		requests = append(requests, request)
+	}
+	f.mu.Unlock()
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Started.Before(requests[j].Started) })
+	return requests
+}
+
+// trackInFlight wraps the handler to record the requests it is handling.
+func (api *MyAPIServer) trackInFlight(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := api.inFlight.add(r)
+		defer api.inFlight.remove(key)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the requests being handled by the server, oldest first.
+func (api *MyAPIServer) InFlight() []InFlightRequest {
+	return api.inFlight.list()
+}
+
+// BeforeShutdown adds a hook run when the server starts shutting down, after readiness was turned off and
+// before the in-flight requests are drained. Hooks run in the order they were added.
+func (api *MyAPIServer) BeforeShutdown(hook ShutdownHook) {
+	if hook == nil {
+		api.configError(&ConfigError{Source: "BeforeShutdown", Err: ErrNilHandler})
+		return
+	}
+	api.beforeShutdown = append(api.beforeShutdown, hook)
+}
+
+// AfterShutdown adds a hook run once the in-flight requests have been drained, or forcibly closed.
+// Hooks run in the order they were added, with a new context ending after DrainTimeout.
+func (api *MyAPIServer) AfterShutdown(hook ShutdownHook) {
+	if hook == nil {
+		api.configError(&ConfigError{Source: "AfterShutdown", Err: ErrNilHandler})
+		return
+	}
+	api.afterShutdown = append(api.afterShutdown, hook)
+}
+
+// runShutdownHooks runs the hooks, logging and returning their errors.
+func (api *MyAPIServer) runShutdownHooks(ctx context.Context, stage string, hooks []ShutdownHook) error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			api.Logger.Printf("%s hook: %v", stage, err)
+			errs = append(errs, fmt.Errorf("%s hook: %w", stage, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ready reports whether the server is accepting traffic: it turns true once the server has started,
+// and false as soon as it starts shutting down.
+func (api *MyAPIServer) Ready() bool {
+	return api.ready.Load()
+}
+
+// SetReady changes the readiness reported by Ready and ReadinessHandler, e.g. while warming caches.
+func (api *MyAPIServer) SetReady(ready bool) {
+	api.ready.Store(ready)
+}
+
+// ReadinessHandler returns a handler answering 200 while the server is ready and 503 once it is
+// shutting down, for load balancer and Kubernetes readiness probes:
+//
+//	app.Get("/readyz", app.ReadinessHandler().ServeHTTP)
+func (api *MyAPIServer) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if !api.Ready() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready"))
+	})
+}
+
+// reportInFlight logs the requests still running when the drain timeout was reached.
+func (api *MyAPIServer) reportInFlight() []InFlightRequest {
+	requests := api.InFlight()
+	for _, request := range requests {
+		api.Logger.Printf("request still running at shutdown: %s %s from %s for %v",
+			request.Method, request.Path, request.RemoteAddr, time.Since(request.Started).Round(time.Millisecond))
+	}
+	return requests
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownHooksAndReadiness(t *testing.T) {
+	api := newTestServer(t, &OptionalParams{ReadinessDelay: 300 * time.Millisecond})
+	api.Get("/readyz", api.ReadinessHandler().ServeHTTP)
+	api.Get("/ping", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong")) })
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+	errHook := errors.New("queue not flushed")
+	api.BeforeShutdown(func(ctx context.Context) error {
+		record("before 1 ready=" + strconv.FormatBool(api.Ready()))
+		return nil
+	})
+	api.BeforeShutdown(func(ctx context.Context) error { record("before 2"); return errHook })
+	api.AfterShutdown(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("after shutdown hook context without deadline")
+		}
+		record("after")
+		return nil
+	})
+	baseURL := startTestServer(t, api)
+	if !api.Ready() {
+		t.Fatal("not ready after Start")
+	}
+	if status := getStatus(t, baseURL+"/readyz"); status != http.StatusOK {
+		t.Fatalf("readiness = %d before shutdown, want 200", status)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- api.Stop(context.Background()) }()
+
+	// During the readiness delay, the probe fails while other requests are still served
+	deadline := time.Now().Add(5 * time.Second)
+	for api.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("still ready after Stop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status := getStatus(t, baseURL+"/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("readiness = %d while draining, want 503", status)
+	}
+	if status := getStatus(t, baseURL+"/ping"); status != http.StatusOK {
+		t.Errorf("GET /ping = %d during the readiness delay, want 200", status)
+	}
+
+	err := <-stopped
+	if !errors.Is(err, errHook) || !strings.Contains(err.Error(), "before shutdown hook") {
+		t.Errorf("Stop = %v, want the hook error", err)
+	}
+	if got, want := strings.Join(events, ", "), "before 1 ready=false, before 2, after"; got != want {
+		t.Errorf("hooks = %s, want %s", got, want)
+	}
+}
+
+// getStatus returns the status of a GET request to the URL.
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestShutdownDrain(t *testing.T) {
+	tests := []struct {
+		name         string
+		drainTimeout time.Duration
+		requestTime  time.Duration
+		wantErr      bool
+		wantRunning  string
+	}{
+		{name: "requests finish", drainTimeout: 5 * time.Second, requestTime: 200 * time.Millisecond},
+		{name: "deadline reached", drainTimeout: 200 * time.Millisecond, requestTime: time.Hour, wantErr: true, wantRunning: "(1 still running)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, &OptionalParams{DrainTimeout: tt.drainTimeout})
+			started := make(chan struct{})
+			api.GetN("/slow", func(ctx ContextHandler) {
+				close(started)
+				select {
+				case <-time.After(tt.requestTime):
+					ctx.Writer.Write([]byte("done"))
+				case <-ctx.Request.Context().Done():
+				}
+			})
+			afterRan := false
+			api.AfterShutdown(func(ctx context.Context) error { afterRan = true; return nil })
+			baseURL := startTestServer(t, api)
+
+			responses := make(chan error, 1)
+			go func() {
+				resp, err := http.Get(baseURL + "/slow")
+				if err == nil {
+					resp.Body.Close()
+				}
+				responses <- err
+			}()
+			<-started
+			running := api.InFlight()
+			if len(running) != 1 || running[0].Method != http.MethodGet || running[0].Path != "/slow" {
+				t.Errorf("InFlight = %+v, want GET /slow", running)
+			}
+
+			err := api.Stop(context.Background())
+			if (err != nil) != tt.wantErr || (tt.wantErr && !strings.Contains(err.Error(), tt.wantRunning)) {
+				t.Errorf("Stop = %v, want error %v %s", err, tt.wantErr, tt.wantRunning)
+			}
+			if responseErr := <-responses; (responseErr != nil) != tt.wantErr {
+				t.Errorf("request error = %v, want error %v", responseErr, tt.wantErr)
+			}
+			if !afterRan {
+				t.Error("after shutdown hook not run")
+			}
+			if len(api.InFlight()) != 0 {
+				t.Errorf("InFlight = %+v after Stop", api.InFlight())
+			}
+		})
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	api := newTestServer(t, &OptionalParams{ReadinessDelay: time.Hour})
+	startTestServer(t, api)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// The context of Stop also ends the readiness delay and the drain
+	api.Stop(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Stop took %v with a 100ms context", elapsed)
+	}
+}
+
+func TestShutdownHookConfigErrors(t *testing.T) {
+	api := newTestServer(t, nil)
+	api.BeforeShutdown(nil)
+	api.AfterShutdown(nil)
+	var errs ConfigErrors
+	if err := api.Validate(); !errors.As(err, &errs) || len(errs) != 2 || errs[0].Source != "BeforeShutdown" || errs[1].Source != "AfterShutdown" {
+		t.Errorf("Validate = %v, want the two nil hooks", err)
+	}
+	if api.DrainTimeout != DefaultDrainTimeout || len(api.ShutdownSignals) != len(DefaultShutdownSignals) {
+		t.Errorf("defaults = %v, %v", api.DrainTimeout, api.ShutdownSignals)
+	}
+}
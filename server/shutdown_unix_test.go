@@ -0,0 +1,43 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunShutdownSignal(t *testing.T) {
+	api := newTestServer(t, &OptionalParams{ShutdownSignals: []os.Signal{syscall.SIGUSR1}})
+	hookRan := make(chan struct{})
+	api.BeforeShutdown(func(ctx context.Context) error { close(hookRan); return nil })
+	errc := make(chan error, 1)
+	go func() { errc <- api.Run() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !api.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("server not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Run = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the shutdown signal")
+	}
+	select {
+	case <-hookRan:
+	default:
+		t.Error("shutdown hook not run")
+	}
+}
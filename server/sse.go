@@ -0,0 +1,504 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MediaTypeEventStream is the media type of Server-Sent Events streams.
+const MediaTypeEventStream = "text/event-stream"
+
+// DefaultSSEHeartbeat is the longest interval between the heartbeat comments of an event stream.
+// Streams send heartbeats at half the server WriteTimeout when it is shorter.
+const DefaultSSEHeartbeat = 15 * time.Second
+
+var (
+	// ErrStreamingUnsupported is returned by ContextHandler.SSE when the ResponseWriter cannot be flushed.
+	ErrStreamingUnsupported = errors.New("streaming unsupported by the response writer")
+
+	// ErrStreamClosed is returned when writing to an event stream that has been closed,
+	// either by the handler, by the client going away or by a failed write.
+	ErrStreamClosed = errors.New("event stream closed")
+)
+
+// SSEEvent is an event sent on an event stream.
+type SSEEvent struct {
+	// ID is the event id, sent back by the client in the Last-Event-ID header when it reconnects.
+	ID string
+
+	// Event is the event type; clients receive events without a type as "message".
+	Event string
+
+	// Data is the event payload. Strings and byte slices are sent as they are, other values as JSON.
+	Data interface{}
+
+	// Retry asks the client to wait this long before reconnecting, when positive.
+	Retry time.Duration
+}
+
+// SSEStream is a Server-Sent Events stream opened with ContextHandler.SSE.
+// Its methods are safe for concurrent use.
+type SSEStream struct {
+	ctx         *ContextHandler
+	controller  *http.ResponseController
+	lastEventID string
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+	done   chan struct{}
+	reset  chan time.Duration
+}
+
+// SSE starts a Server-Sent Events stream: it sends the text/event-stream headers and returns the stream,
+// which the handler writes events to until the client goes away. The stream sends heartbeat comments to
+// keep idle connections open and extends the write deadline by WriteTimeout before every write,
+// so that the server timeout only ends streams that stopped making progress.
+// The handler must close the stream before returning, typically with defer stream.Close().
+// It returns ErrStreamingUnsupported when the ResponseWriter cannot be flushed.
+func (ctx *ContextHandler) SSE() (*SSEStream, error) {
+	controller := http.NewResponseController(ctx.Writer)
+	extendWriteDeadline(ctx, controller)
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", MediaTypeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	if err := controller.Flush(); err != nil {
+		header.Del("Content-Type")
+		header.Del("Cache-Control")
+		header.Del("X-Accel-Buffering")
+		if errors.Is(err, http.ErrNotSupported) {
+			return nil, ErrStreamingUnsupported
+		}
+		return nil, err
+	}
+
+	stream := &SSEStream{
+		ctx:         ctx,
+		controller:  controller,
+		lastEventID: ctx.Request.Header.Get("Last-Event-ID"),
+		done:        make(chan struct{}),
+		reset:       make(chan time.Duration, 1),
+	}
+	go stream.heartbeat(defaultHeartbeat(ctx))
+	return stream, nil
+}
+
+// defaultHeartbeat returns the heartbeat interval of the streams of the server.
+func defaultHeartbeat(ctx *ContextHandler) time.Duration {
+	if ctx.api != nil && ctx.api.WriteTimeout > 0 && ctx.api.WriteTimeout/2 < DefaultSSEHeartbeat {
+		return ctx.api.WriteTimeout / 2
+	}
+	return DefaultSSEHeartbeat
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client, or an empty string.
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel closed when the stream ends, because the client went away or the stream was closed.
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the stream ended, or nil while it is open.
+func (s *SSEStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Send sends an event with the provided type, id and data. Empty event types and ids are left out.
+func (s *SSEStream) Send(event, id string, data interface{}) error {
+	return s.SendEvent(SSEEvent{ID: id, Event: event, Data: data})
+}
+
+// SendEvent sends the event and flushes it to the client.
+func (s *SSEStream) SendEvent(event SSEEvent) error {
+	var b strings.Builder
+	if event.Event != "" {
+		writeSSEField(&b, "event", event.Event)
+	}
+	if event.ID != "" {
+		writeSSEField(&b, "id", event.ID)
+	}
+	if event.Retry > 0 {
+		writeSSEField(&b, "retry", strconv.FormatInt(event.Retry.Milliseconds(), 10))
+	}
+	if event.Data != nil {
+		data, err := s.encodeData(event.Data)
+		if err != nil {
+			return err
+		}
+		writeSSEField(&b, "data", data)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Retry asks the client to wait for the provided duration before reconnecting after the stream ends.
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Comment sends a comment line, which clients ignore.
+func (s *SSEStream) Comment(text string) error {
+	var b strings.Builder
+	writeSSEField(&b, "", text)
+	return s.write(b.String())
+}
+
+// Heartbeat changes the interval between the heartbeat comments sent while the stream is idle.
+// A zero interval stops the heartbeats; idle streams are then ended by the server WriteTimeout, if any.
+func (s *SSEStream) Heartbeat(interval time.Duration) {
+	for {
+		select {
+		case s.reset <- interval:
+			return
+		case <-s.done:
+			return
+		default:
+			// Replace a change that has not been picked up yet
+			select {
+			case <-s.reset:
+			default:
+			}
+		}
+	}
+}
+
+// Close ends the stream. Further writes return ErrStreamClosed.
+func (s *SSEStream) Close() {
+	s.close(ErrStreamClosed)
+}
+
+// close ends the stream with the provided reason.
+func (s *SSEStream) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked(err)
+}
+
+// encodeData returns the data of an event as text.
+func (s *SSEStream) encodeData(data interface{}) (string, error) {
+	switch data := data.(type) {
+	case string:
+		return data, nil
+	case []byte:
+		return string(data), nil
+	}
+	jsonBytes, err := s.ctx.encodeJSON(data, "")
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// write writes the text to the client and flushes it, ending the stream on failure.
+func (s *SSEStream) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Request.Context().Err(); err != nil {
+		s.closeLocked(err)
+		return err
+	}
+	extendWriteDeadline(s.ctx, s.controller)
+	if _, err := s.ctx.Writer.Write([]byte(text)); err != nil {
+		s.closeLocked(err)
+		return err
+	}
+	if err := s.controller.Flush(); err != nil {
+		s.closeLocked(err)
+		return err
+	}
+	return nil
+}
+
+// closeLocked ends the stream while s.mu is held.
+func (s *SSEStream) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.done)
+}
+
+// heartbeat sends a comment every interval until the stream ends,
+// which also ends the stream once the client goes away.
+func (s *SSEStream) heartbeat(interval time.Duration) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ctx.Request.Context().Done():
+			s.close(s.ctx.Request.Context().Err())
+			return
+		case interval = <-s.reset:
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			}
+			if interval > 0 {
+				ticker = time.NewTicker(interval)
+				tick = ticker.C
+			}
+		case <-tick:
+			s.Comment("heartbeat")
+		}
+	}
+}
+
+// writeSSEField writes a field of an event, repeating the field for each line of a multi-line value.
+// An empty name writes comment lines.
+func writeSSEField(b *strings.Builder, name, value string) {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	value = strings.ReplaceAll(value, "\r", "\n")
+	for _, line := range strings.Split(value, "\n") {
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+}
+
+// SSEBroker fans events out to the event streams subscribed to their topic.
+// It keeps the latest events of each topic so that reconnecting clients can resume
+// from their Last-Event-ID. Its methods are safe for concurrent use.
+type SSEBroker struct {
+	// HistorySize is the number of events kept per topic for Last-Event-ID resumption.
+	HistorySize int
+
+	// BufferSize is the number of events queued for a subscriber before it is considered too slow and dropped.
+	BufferSize int
+
+	mu          sync.Mutex
+	seq         uint64
+	history     map[string][]sseEntry
+	subscribers map[*SSESubscription]struct{}
+	closed      bool
+}
+
+// sseEntry is an event published on a topic, with its sequence number.
+type sseEntry struct {
+	seq   uint64
+	event SSEEvent
+}
+
+// SSESubscription receives the events published on some topics of a broker.
+type SSESubscription struct {
+	broker *SSEBroker
+	topics map[string]bool
+	events chan SSEEvent
+	once   sync.Once
+}
+
+// NewSSEBroker creates an SSEBroker keeping 100 events per topic and queueing 64 events per subscriber.
+func NewSSEBroker() *SSEBroker {
+	return &SSEBroker{
+		HistorySize: 100,
+		BufferSize:  64,
+		history:     make(map[string][]sseEntry),
+		subscribers: make(map[*SSESubscription]struct{}),
+	}
+}
+
+// SSEBroker returns the broker of the server, creating it on first use. It is closed when the server shuts down.
+func (api *MyAPIServer) SSEBroker() *SSEBroker {
+	api.sseOnce.Do(func() {
+		api.sseBroker = NewSSEBroker()
+	})
+	return api.sseBroker
+}
+
+// Publish sends the event to the subscribers of the topic. Events without an ID are numbered by the broker,
+// which allows clients to resume after them. Subscribers whose queue is full are dropped.
+func (b *SSEBroker) Publish(topic string, event SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(b.seq, 10)
+	}
+	if b.HistorySize > 0 {
+		history := append(b.history[topic], sseEntry{seq: b.seq, event: event})
+		if len(history) > b.HistorySize {
+			history = history[len(history)-b.HistorySize:]
+		}
+		b.history[topic] = history
+	}
+
+	for sub := range b.subscribers {
+		if !sub.topics[topic] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// The subscriber cannot keep up: drop it rather than blocking every publisher
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe subscribes to the topics. Events published after the provided event id are replayed first,
+// when they are still in the history; an empty id replays nothing.
+func (b *SSEBroker) Subscribe(lastEventID string, topics ...string) *SSESubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &SSESubscription{broker: b, topics: make(map[string]bool, len(topics))}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+	replay := b.replayLocked(lastEventID, sub.topics)
+	size := b.BufferSize
+	if size < len(replay) {
+		size = len(replay)
+	}
+	sub.events = make(chan SSEEvent, size)
+	for _, event := range replay {
+		sub.events <- event
+	}
+
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// replayLocked returns the events of the topics published after the event with the provided id, in order.
+func (b *SSEBroker) replayLocked(lastEventID string, topics map[string]bool) []SSEEvent {
+	if lastEventID == "" {
+		return nil
+	}
+
+	// Find the sequence number of the last event seen by the client
+	var after uint64
+	found := false
+	for topic := range topics {
+		for _, entry := range b.history[topic] {
+			if entry.event.ID == lastEventID {
+				after, found = entry.seq, true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	var entries []sseEntry
+	for topic := range topics {
+		for _, entry := range b.history[topic] {
+			if entry.seq > after {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	events := make([]SSEEvent, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	return events
+}
+
+// Serve subscribes the stream to the topics, resuming after its Last-Event-ID, and forwards the events
+// to it until the client goes away, the stream fails or the broker is closed.
+func (b *SSEBroker) Serve(stream *SSEStream, topics ...string) error {
+	sub := b.Subscribe(stream.LastEventID(), topics...)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-stream.Done():
+			return stream.Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if err := stream.SendEvent(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ServeSSE opens an event stream on the request and serves the topics on it with Serve.
+// Errors are answered through the error renderer while the stream has not started.
+func (b *SSEBroker) ServeSSE(ctx ContextHandler, topics ...string) {
+	stream, err := ctx.SSE()
+	if err != nil {
+		ctx.Error(&HTTPError{Status: http.StatusInternalServerError, Err: err})
+		return
+	}
+	defer stream.Close()
+	b.Serve(stream, topics...)
+}
+
+// Close ends all subscriptions and ignores further publications. Streams served by the broker return.
+func (b *SSEBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.removeLocked(sub)
+	}
+}
+
+// removeLocked removes the subscriber and closes its channel while b.mu is held.
+func (b *SSEBroker) removeLocked(sub *SSESubscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Events returns the channel receiving the events of the subscription.
+// It is closed when the subscription ends, by Unsubscribe, by the broker closing or by the subscriber falling behind.
+func (s *SSESubscription) Events() <-chan SSEEvent {
+	return s.events
+}
+
+// Unsubscribe ends the subscription.
+func (s *SSESubscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.broker.mu.Lock()
+		defer s.broker.mu.Unlock()
+		s.broker.removeLocked(s)
+	})
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSEFraming(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(stream *SSEStream) error
+		want string
+	}{
+		{
+			name: "data only",
+			send: func(stream *SSEStream) error { return stream.Send("", "", "hello") },
+			want: "data: hello\n\n",
+		},
+		{
+			name: "event and id",
+			send: func(stream *SSEStream) error { return stream.Send("progress", "7", "50%") },
+			want: "event: progress\nid: 7\ndata: 50%\n\n",
+		},
+		{
+			name: "multi-line data",
+			send: func(stream *SSEStream) error { return stream.Send("", "", "a\nb\r\nc\rd") },
+			want: "data: a\ndata: b\ndata: c\ndata: d\n\n",
+		},
+		{
+			name: "JSON data",
+			send: func(stream *SSEStream) error { return stream.Send("", "", map[string]int{"done": 3}) },
+			want: "data: {\"done\":3}\n\n",
+		},
+		{
+			name: "bytes data",
+			send: func(stream *SSEStream) error { return stream.Send("", "", []byte("raw")) },
+			want: "data: raw\n\n",
+		},
+		{
+			name: "retry in event",
+			send: func(stream *SSEStream) error {
+				return stream.SendEvent(SSEEvent{Event: "ping", Retry: 1500 * time.Millisecond})
+			},
+			want: "event: ping\nretry: 1500\n\n",
+		},
+		{
+			name: "retry hint",
+			send: func(stream *SSEStream) error { return stream.Retry(3 * time.Second) },
+			want: "retry: 3000\n\n",
+		},
+		{
+			name: "comment",
+			send: func(stream *SSEStream) error { return stream.Comment("keep\nalive") },
+			want: ": keep\n: alive\n",
+		},
+		{
+			name: "after close",
+			send: func(stream *SSEStream) error {
+				stream.Close()
+				if err := stream.Send("", "", "late"); !errors.Is(err, ErrStreamClosed) {
+					t.Errorf("Send after Close = %v, want ErrStreamClosed", err)
+				}
+				return nil
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.GetN("/events", func(ctx ContextHandler) {
+				stream, err := ctx.SSE()
+				if err != nil {
+					t.Fatalf("SSE: %v", err)
+				}
+				defer stream.Close()
+				if err := tt.send(stream); err != nil {
+					t.Errorf("send: %v", err)
+				}
+			})
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+			if got := w.Header().Get("Content-Type"); got != MediaTypeEventStream {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+				t.Errorf("Cache-Control = %q", got)
+			}
+			if w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSEStreamingUnsupported(t *testing.T) {
+	api := newTestServer(t, nil)
+	ctx := api.newContextHandler(&plainWriter{header: http.Header{}}, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if _, err := ctx.SSE(); !errors.Is(err, ErrStreamingUnsupported) {
+		t.Fatalf("SSE = %v, want ErrStreamingUnsupported", err)
+	}
+	if got := ctx.Writer.Header().Get("Content-Type"); got != "" {
+		t.Errorf("Content-Type = %q left after the failure", got)
+	}
+}
+
+// failingWriter is a flushable ResponseWriter whose writes fail after a delay, reporting each attempt.
+type failingWriter struct {
+	header  http.Header
+	writing chan struct{}
+}
+
+func (w *failingWriter) Header() http.Header  { return w.header }
+func (w *failingWriter) WriteHeader(code int) {}
+func (w *failingWriter) Flush()               {}
+func (w *failingWriter) Write(b []byte) (int, error) {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	time.Sleep(10 * time.Millisecond)
+	return 0, errors.New("connection reset")
+}
+
+func TestSSECloseWhileWriteFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(stream *SSEStream)
+	}{
+		{name: "send", write: func(stream *SSEStream) { stream.Send("", "", "data") }},
+		{name: "heartbeat", write: func(stream *SSEStream) { stream.Heartbeat(time.Millisecond) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			w := &failingWriter{header: http.Header{}, writing: make(chan struct{}, 1)}
+			ctx := api.newContextHandler(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+			stream, err := ctx.SSE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			go tt.write(stream)
+			<-w.writing
+
+			// Close while the write holds the stream and fails
+			closed := make(chan struct{})
+			go func() {
+				stream.Close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Close deadlocked with the failing write")
+			}
+			select {
+			case <-stream.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream not done")
+			}
+			if err := stream.Send("", "", "more"); err == nil {
+				t.Error("Send after Close succeeded")
+			}
+		})
+	}
+}
+
+// readEvents reads the event stream until n blocks separated by blank lines have been received.
+func readEvents(t *testing.T, reader *bufio.Reader, n int) []string {
+	t.Helper()
+	var (
+		blocks []string
+		block  strings.Builder
+	)
+	for len(blocks) < n {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream after %q: %v", blocks, err)
+		}
+		if line == "\n" {
+			blocks = append(blocks, block.String())
+			block.Reset()
+			continue
+		}
+		block.WriteString(line)
+	}
+	return blocks
+}
+
+func TestSSEHeartbeatAndWriteTimeout(t *testing.T) {
+	api := newTestServer(t, &OptionalParams{WriteTimeout: 200 * time.Millisecond})
+	api.GetN("/events", func(ctx ContextHandler) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Errorf("SSE: %v", err)
+			return
+		}
+		defer stream.Close()
+		// Stay idle for longer than WriteTimeout: the heartbeats keep the stream alive
+		time.Sleep(600 * time.Millisecond)
+		stream.Send("done", "", "bye")
+	})
+	baseURL := startTestServer(t, api)
+
+	resp, err := http.Get(baseURL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	}
+	if strings.Count(string(body), ": heartbeat\n") < 2 {
+		t.Errorf("body = %q, want heartbeat comments", body)
+	}
+	if !strings.HasSuffix(string(body), "event: done\ndata: bye\n\n") {
+		t.Errorf("body = %q, want the final event", body)
+	}
+}
+
+func TestSSEClientGone(t *testing.T) {
+	api := newTestServer(t, nil)
+	ended := make(chan error, 1)
+	api.GetN("/events", func(ctx ContextHandler) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Errorf("SSE: %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Send("", "", "first")
+		<-stream.Done()
+		ended <- stream.Err()
+	})
+	server := httptest.NewServer(api.ServMConfigure(nil))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readEvents(t, bufio.NewReader(resp.Body), 1)
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Err = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not ended after the client went away")
+	}
+}
+
+func TestSSEBrokerReplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastEventID string
+		topics      []string
+		want        []string
+	}{
+		{name: "no id", topics: []string{"a"}},
+		{name: "resume one topic", lastEventID: "1", topics: []string{"a"}, want: []string{"a3", "a5"}},
+		{name: "resume several topics", lastEventID: "2", topics: []string{"a", "b"}, want: []string{"a3", "b4", "a5"}},
+		{name: "id of another topic", lastEventID: "2", topics: []string{"a"}},
+		{name: "unknown id", lastEventID: "42", topics: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := NewSSEBroker()
+			for _, published := range []string{"a1", "b2", "a3", "b4", "a5"} {
+				broker.Publish(published[:1], SSEEvent{Data: published})
+			}
+			sub := broker.Subscribe(tt.lastEventID, tt.topics...)
+			defer sub.Unsubscribe()
+			var got []string
+			for len(got) < len(tt.want) {
+				event := <-sub.Events()
+				got = append(got, event.Data.(string))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+			select {
+			case event := <-sub.Events():
+				t.Errorf("unexpected event %+v", event)
+			default:
+			}
+		})
+	}
+}
+
+func TestSSEBrokerFanOut(t *testing.T) {
+	broker := NewSSEBroker()
+	broker.HistorySize = 2
+	broker.BufferSize = 1
+	fast := broker.Subscribe("", "jobs")
+	slow := broker.Subscribe("", "jobs")
+	other := broker.Subscribe("", "other")
+
+	broker.Publish("jobs", SSEEvent{Event: "progress", Data: "1"})
+	if event := <-fast.Events(); event.ID != "1" || event.Event != "progress" {
+		t.Errorf("event = %+v, want progress with ID 1", event)
+	}
+	// The slow subscriber has not read its first event: the second one drops it
+	broker.Publish("jobs", SSEEvent{ID: "custom", Data: "2"})
+	if event := <-fast.Events(); event.ID != "custom" {
+		t.Errorf("event = %+v, want the ID set by the publisher", event)
+	}
+	<-slow.Events()
+	if _, ok := <-slow.Events(); ok {
+		t.Error("slow subscriber not dropped")
+	}
+	select {
+	case event := <-other.Events():
+		t.Errorf("subscriber of another topic received %+v", event)
+	default:
+	}
+
+	broker.Close()
+	for _, sub := range []*SSESubscription{fast, other} {
+		if _, ok := <-sub.Events(); ok {
+			t.Error("subscription not ended by Close")
+		}
+		sub.Unsubscribe()
+	}
+	// Subscriptions after Close are ended immediately
+	if _, ok := <-broker.Subscribe("", "jobs").Events(); ok {
+		t.Error("subscription after Close received an event")
+	}
+}
+
+func TestSSEBrokerServe(t *testing.T) {
+	api := newTestServer(t, nil)
+	broker := api.SSEBroker()
+	var subscribed sync.WaitGroup
+	subscribed.Add(1)
+	api.GetN("/events/{topic}", func(ctx ContextHandler) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Errorf("SSE: %v", err)
+			return
+		}
+		defer stream.Close()
+		go func() {
+			// Wait for the subscription made by Serve before publishing
+			for {
+				broker.mu.Lock()
+				n := len(broker.subscribers)
+				broker.mu.Unlock()
+				if n > 0 {
+					subscribed.Done()
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+		broker.Serve(stream, ctx.Param("topic"))
+	})
+	broker.Publish("jobs", SSEEvent{Event: "progress", Data: "10%"})
+	broker.Publish("jobs", SSEEvent{Event: "progress", Data: "20%"})
+	server := httptest.NewServer(api.ServMConfigure(nil))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events/jobs", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	subscribed.Wait()
+	broker.Publish("jobs", SSEEvent{Event: "progress", Data: map[string]int{"percent": 30}})
+
+	got := readEvents(t, reader, 2)
+	want := []string{"event: progress\nid: 2\ndata: 20%\n", "event: progress\nid: 3\ndata: {\"percent\":30}\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	// Closing the broker ends the served streams
+	broker.Close()
+	if rest, err := io.ReadAll(reader); err != nil || len(rest) != 0 {
+		t.Errorf("after Close: %q, %v", rest, err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// StreamIterator produces the elements of a streamed response by calling yield with each of them in turn.
+// yield returns false once the stream cannot continue, because the client went away or a write failed,
+// and the iterator should then stop and return. An error returned by the iterator ends the stream.
+//
+// A database cursor can be streamed as:
+//
+//	func(yield func(v interface{}) bool) error {
+//		for rows.Next() {
+//			var item Item
+//			if err := rows.Scan(&item.ID, &item.Name); err != nil {
+//				return err
+//			}
+//			if !yield(item) {
+//				return nil
+//			}
+//		}
+//		return rows.Err()
+//	}
+type StreamIterator func(yield func(v interface{}) bool) error
+
+// jsonStream writes the elements of a streamed JSON response, flushing each of them to the client.
+type jsonStream struct {
+	ctx         *ContextHandler
+	controller  *http.ResponseController
+	contentType string
+	open        string
+	separator   string
+	terminator  string
+	close       string
+	started     bool
+	count       int
+	err         error
+}
+
+// StreamJSONArray writes the elements produced by the iterator as a JSON array, one element at a time,
+// so that large results do not have to be held in memory. Each element is marshalled with the server
+// JSONOptions, without indentation, and flushed to the client as soon as it is written.
+//
+// The stream stops when the request context is cancelled. The write deadline is extended by WriteTimeout
+// before each element, so that long streams are not cut off by the server timeout while they make progress.
+//
+// An error returned by the iterator before any element was written is answered through the error renderer.
+// Once the response has started, the array is left unterminated so that clients cannot mistake a truncated
+// stream for a complete one. The error ending the stream, if any, is returned.
+func (ctx *ContextHandler) StreamJSONArray(iter StreamIterator) error {
+	return ctx.stream(iter, &jsonStream{contentType: MediaTypeJSON, open: "[", separator: ",", close: "]"})
+}
+
+// NDJSON writes the elements produced by the iterator as newline-delimited JSON (application/x-ndjson),
+// one compact JSON value per line. It streams like StreamJSONArray; each line is terminated as soon as its
+// element is written, so clients can process it right away. A stream ended by an error stops after its last
+// complete line.
+func (ctx *ContextHandler) NDJSON(iter StreamIterator) error {
+	return ctx.stream(iter, &jsonStream{contentType: MediaTypeNDJSON, terminator: "\n"})
+}
+
+// stream runs the iterator, writing its elements through the provided stream.
+func (ctx *ContextHandler) stream(iter StreamIterator, s *jsonStream) error {
+	s.ctx = ctx
+	s.controller = http.NewResponseController(ctx.Writer)
+
+	err := iter(s.yield)
+	if err == nil {
+		err = s.err
+	}
+	if err == nil {
+		// Close the stream, opening it first for empty results
+		s.start()
+		if s.count > 0 || s.open != "" {
+			s.write(s.close)
+		}
+		s.flush()
+		return s.err
+	}
+
+	// The client went away: there is nobody left to answer
+	if ctx.Request.Context().Err() != nil {
+		return err
+	}
+
+	// Nothing has been sent yet: the error can still be answered properly
+	if !s.started {
+		ctx.Error(err)
+		return err
+	}
+	ctx.logf("stream %s %s ended after %d elements: %v", ctx.Request.Method, ctx.Request.URL.Path, s.count, err)
+	return err
+}
+
+// yield writes one element of the stream. It returns false once the stream cannot continue.
+func (s *jsonStream) yield(v interface{}) bool {
+	if s.err != nil {
+		return false
+	}
+	if err := s.ctx.Request.Context().Err(); err != nil {
+		s.err = err
+		return false
+	}
+	jsonBytes, err := s.ctx.encodeJSON(v, "")
+	if err != nil {
+		s.err = &HTTPError{Status: http.StatusInternalServerError, Err: err}
+		return false
+	}
+
+	extendWriteDeadline(s.ctx, s.controller)
+	s.start()
+	if s.count > 0 {
+		s.write(s.separator)
+	}
+	s.write(string(jsonBytes))
+	s.write(s.terminator)
+	s.count++
+	s.flush()
+	return s.err == nil
+}
+
+// start sets the headers and writes the opening of the stream before the first element.
+// The headers are sent with the first write or flush, with the status set by ContextHandler.Status, if any.
+func (s *jsonStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	header := s.ctx.Writer.Header()
+	header.Set("Content-Type", s.contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	s.write(s.open)
+}
+
+// write writes the text to the response, recording the first write error.
+func (s *jsonStream) write(text string) {
+	if s.err != nil || text == "" {
+		return
+	}
+	if _, err := s.ctx.Writer.Write([]byte(text)); err != nil {
+		s.err = err
+	}
+}
+
+// flush sends the buffered data to the client when the ResponseWriter supports it.
+func (s *jsonStream) flush() {
+	if s.err != nil {
+		return
+	}
+	if err := s.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.err = err
+	}
+}
+
+// extendWriteDeadline pushes the write deadline of the connection WriteTimeout into the future,
+// so that long-lived responses are not cut off while they make progress.
+// ResponseWriters without deadline support are left alone.
+func extendWriteDeadline(ctx *ContextHandler, controller *http.ResponseController) {
+	if ctx.api == nil || ctx.api.WriteTimeout <= 0 {
+		return
+	}
+	controller.SetWriteDeadline(time.Now().Add(ctx.api.WriteTimeout))
+}
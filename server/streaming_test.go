@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// elements returns an iterator yielding the values, then returning err.
+func elements(err error, values ...interface{}) StreamIterator {
+	return func(yield func(v interface{}) bool) error {
+		for _, v := range values {
+			if !yield(v) {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	errFailed := errors.New("cursor failed")
+	tests := []struct {
+		name            string
+		ndjson          bool
+		iter            StreamIterator
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantErr         error
+	}{
+		{name: "array", iter: elements(nil, 1, "two", map[string]int{"three": 3}), wantContentType: MediaTypeJSON, wantBody: `[1,"two",{"three":3}]`},
+		{name: "empty array", iter: elements(nil), wantContentType: MediaTypeJSON, wantBody: `[]`},
+		{name: "array error before elements", iter: elements(errFailed), wantStatus: http.StatusInternalServerError, wantContentType: "application/problem+json", wantErr: errFailed},
+		{name: "array error after elements", iter: elements(errFailed, 1, 2), wantContentType: MediaTypeJSON, wantBody: `[1,2`, wantErr: errFailed},
+		{name: "array marshal error", iter: elements(nil, 1, make(chan int)), wantContentType: MediaTypeJSON, wantBody: `[1`, wantErr: &HTTPError{}},
+		{name: "ndjson", ndjson: true, iter: elements(nil, 1, "two", map[string]int{"three": 3}), wantContentType: MediaTypeNDJSON, wantBody: "1\n\"two\"\n{\"three\":3}\n"},
+		{name: "empty ndjson", ndjson: true, iter: elements(nil), wantContentType: MediaTypeNDJSON, wantBody: ""},
+		{name: "ndjson error after elements", ndjson: true, iter: elements(errFailed, 1, 2), wantContentType: MediaTypeNDJSON, wantBody: "1\n2\n", wantErr: errFailed},
+		{name: "ndjson error before elements", ndjson: true, iter: elements(NewHTTPError(http.StatusNotFound, "no export")), wantStatus: http.StatusNotFound, wantContentType: "application/problem+json", wantErr: &HTTPError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			var err error
+			api.GetN("/export", func(ctx ContextHandler) {
+				if tt.ndjson {
+					err = ctx.NDJSON(tt.iter)
+				} else {
+					err = ctx.StreamJSONArray(tt.iter)
+				}
+			})
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("stream error = %v, want nil", err)
+				}
+			case *HTTPError:
+				if !errors.As(err, &want) {
+					t.Errorf("stream error = %v, want an *HTTPError", err)
+				}
+			default:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("stream error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if w.Code != wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if tt.wantBody != "" || wantStatus == http.StatusOK {
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamJSONIncremental(t *testing.T) {
+	api := newTestServer(t, nil)
+	next := make(chan struct{})
+	api.GetN("/export", func(ctx ContextHandler) {
+		ctx.NDJSON(func(yield func(v interface{}) bool) error {
+			for i := 1; i <= 3; i++ {
+				if !yield(i) {
+					return nil
+				}
+				<-next
+			}
+			return nil
+		})
+	})
+	server := httptest.NewServer(api.ServMConfigure(nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for i := 1; i <= 3; i++ {
+		// Each line arrives before the next element is produced
+		line, err := reader.ReadString('\n')
+		if err != nil || line != string(rune('0'+i))+"\n" {
+			t.Fatalf("line %d = %q, %v", i, line, err)
+		}
+		next <- struct{}{}
+	}
+	if rest, _ := io.ReadAll(reader); len(rest) != 0 {
+		t.Errorf("trailing data %q", rest)
+	}
+}
+
+func TestStreamJSONCancelled(t *testing.T) {
+	api := newTestServer(t, nil)
+	done := make(chan int, 1)
+	api.GetN("/export", func(ctx ContextHandler) {
+		count := 0
+		ctx.StreamJSONArray(func(yield func(v interface{}) bool) error {
+			for yield(count) {
+				count++
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		})
+		done <- count
+	})
+	server := httptest.NewServer(api.ServMConfigure(nil))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/export", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	io.ReadFull(resp.Body, buf)
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case count := <-done:
+		if count == 0 {
+			t.Error("no element streamed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop after the client went away")
+	}
+}
+
+func TestStreamJSONWriteTimeout(t *testing.T) {
+	const elementCount = 6
+	api := newTestServer(t, &OptionalParams{WriteTimeout: 200 * time.Millisecond})
+	api.GetN("/export", func(ctx ContextHandler) {
+		ctx.NDJSON(func(yield func(v interface{}) bool) error {
+			for i := 0; i < elementCount; i++ {
+				// The stream lasts longer than WriteTimeout but makes progress within it
+				time.Sleep(100 * time.Millisecond)
+				if !yield(i) {
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+	baseURL := startTestServer(t, api)
+
+	resp, err := http.Get(baseURL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	}
+	if lines := strings.Count(string(body), "\n"); lines != elementCount {
+		t.Errorf("received %d lines, want %d: %q", lines, elementCount, body)
+	}
+}
@@ -0,0 +1,345 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultCertReloadInterval is the interval at which certificate files are checked for changes.
+const DefaultCertReloadInterval = 30 * time.Second
+
+// ErrInvalidTLS is reported when the TLS options cannot be used, e.g. unreadable certificate files.
+var ErrInvalidTLS = errors.New("invalid TLS configuration")
+
+// TLSOptions configures HTTPS. The server uses TLS when certificate and key files are set, or when
+// Config provides certificates.
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM files of the server certificate chain and private key.
+	// They are reloaded when they change on disk.
+	CertFile string
+	KeyFile  string
+
+	// Config is the base TLS configuration; it is cloned and completed with the other options.
+	Config *tls.Config
+
+	// MinVersion is the minimum TLS version accepted (TLS 1.2 when 0).
+	MinVersion uint16
+
+	// CipherSuites restricts the cipher suites used up to TLS 1.2; the defaults of crypto/tls are used when empty.
+	CipherSuites []uint16
+
+	// ReloadInterval is how often the certificate files are checked for changes (30s when 0, disabled when negative).
+	ReloadInterval time.Duration
+
+	// ClientCAFile is a PEM bundle of the certificate authorities trusted for client certificates (mutual TLS).
+	ClientCAFile string
+
+	// ClientCAs is a pool of certificate authorities trusted for client certificates, added to ClientCAFile.
+	ClientCAs *x509.CertPool
+
+	// ClientAuth is the client certificate policy. It defaults to tls.RequireAndVerifyClientCert when client
+	// certificate authorities are set; use tls.VerifyClientCertIfGiven to make client certificates optional.
+	ClientAuth tls.ClientAuthType
+
+	// RedirectAddr is the address of an optional plain HTTP listener redirecting every request to HTTPS, e.g. ":80".
+	RedirectAddr string
+}
+
+// enabled reports whether the options configure HTTPS.
+func (options TLSOptions) enabled() bool {
+	if options.CertFile != "" || options.KeyFile != "" {
+		return true
+	}
+	return options.Config != nil && (len(options.Config.Certificates) > 0 || options.Config.GetCertificate != nil || options.Config.GetConfigForClient != nil)
+}
+
+// ClientIdentity describes the verified certificate presented by a client over mutual TLS.
+type ClientIdentity struct {
+	// Certificate is the verified client certificate.
+	Certificate *x509.Certificate
+
+	// CommonName is the common name of the certificate subject.
+	CommonName string
+
+	// DNSNames, EmailAddresses and URIs are the subject alternative names of the certificate.
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []*url.URL
+
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate.
+	Fingerprint string
+}
+
+// ClientIdentity returns the identity of the client certificate verified during the TLS handshake.
+// It reports false for plain HTTP requests and for clients without a verified certificate.
+func (ctx *ContextHandler) ClientIdentity() (*ClientIdentity, bool) {
+	return RequestClientIdentity(ctx.Request)
+}
+
+// RequestClientIdentity returns the identity of the verified client certificate of the request,
+// for standard handlers. It reports false when the request has no verified client certificate.
+func RequestClientIdentity(r *http.Request) (*ClientIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	sum := sha256.Sum256(cert.Raw)
+	return &ClientIdentity{
+		Certificate:    cert,
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Fingerprint:    hex.EncodeToString(sum[:]),
+	}, true
+}
+
+// certReloader serves a certificate loaded from files, reloading it when the files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *log.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newCertReloader loads the certificate from the files.
+func newCertReloader(certFile, keyFile string, logger *log.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger, stop: make(chan struct{})}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, as used by tls.Config.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate again if either file changed since the last load, and reports whether it did.
+// The current certificate is kept when the new files cannot be loaded, e.g. while they are being replaced.
+func (r *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && certInfo.ModTime().Equal(r.certTime) && keyInfo.ModTime().Equal(r.keyTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certTime = certInfo.ModTime()
+	r.keyTime = keyInfo.ModTime()
+	r.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the certificate every interval until close is called.
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Printf("reloading certificate %s: %v", r.certFile, err)
+			} else if reloaded {
+				r.logger.Printf("reloaded certificate %s", r.certFile)
+			}
+		}
+	}
+}
+
+// close stops watching the certificate files.
+func (r *certReloader) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// ReloadCertificate loads the certificate files again if they changed, without waiting for the next check.
+// It returns an error, and keeps serving the current certificate, when the files cannot be loaded.
+func (api *MyAPIServer) ReloadCertificate() error {
+	if api.certReloader == nil {
+		return fmt.Errorf("%w: no certificate files configured", ErrInvalidTLS)
+	}
+	_, err := api.certReloader.reload()
+	return err
+}
+
+// TLSConfig returns the TLS configuration built from the TLS options, or nil when HTTPS is not configured.
+// The server serves with a copy made when it starts, which HTTP/2 support completes with its protocols.
+func (api *MyAPIServer) TLSConfig() *tls.Config {
+	return api.tlsConfig
+}
+
+// buildTLSConfig builds the TLS configuration of the server from its options.
+func (api *MyAPIServer) buildTLSConfig() (*tls.Config, error) {
+	options := api.TLS
+	config := &tls.Config{}
+	if options.Config != nil {
+		config = options.Config.Clone()
+	}
+	if options.MinVersion != 0 {
+		config.MinVersion = options.MinVersion
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if len(options.CipherSuites) > 0 {
+		config.CipherSuites = options.CipherSuites
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		reloader, err := newCertReloader(options.CertFile, options.KeyFile, api.Logger)
+		if err != nil {
+			return nil, err
+		}
+		api.certReloader = reloader
+		config.GetCertificate = reloader.GetCertificate
+	}
+
+	clientCAs := options.ClientCAs
+	if options.ClientCAFile != "" {
+		pem, err := os.ReadFile(options.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		if clientCAs == nil {
+			clientCAs = x509.NewCertPool()
+		} else {
+			clientCAs = clientCAs.Clone()
+		}
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.ClientCAFile)
+		}
+	}
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		if options.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	if options.ClientAuth != tls.NoClientCert {
+		config.ClientAuth = options.ClientAuth
+	}
+	return config, nil
+}
+
+// redirectHandler redirects every request to the same URL over HTTPS, on the provided port of the server.
+// Requests without a Host header, such as HTTP/1.0 ones, go to the host of Addr, or are answered with 400
+// when Addr has no host.
+func (api *MyAPIServer) redirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if host == "" {
+			host = api.Addr
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "missing Host header", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// 308 keeps the method and body of the request
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// redirectPort returns the port HTTP requests are redirected to: the port of the first TCP listener of the server,
+// which is the actual port when Addr uses port 0 or the listeners were provided, or else the port of Addr.
+func (api *MyAPIServer) redirectPort(listeners []net.Listener) string {
+	for _, listener := range listeners {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+			return strconv.Itoa(addr.Port)
+		}
+	}
+	_, port, _ := net.SplitHostPort(api.Addr)
+	return port
+}
+
+// startRedirectServer starts the HTTP to HTTPS redirect listener, if configured, reusing the socket handed
+// over by a graceful restart. Requests are redirected to the port of the listeners of the server.
+// Errors binding the address are returned; errors while serving are logged.
+func (api *MyAPIServer) startRedirectServer(listeners []net.Listener) error {
+	if api.TLS.RedirectAddr == "" || api.tlsConfig == nil {
+		if api.redirectListener != nil {
+			// Handed over by a graceful restart, but no longer configured
+			api.redirectListener.Close()
+			api.redirectListener = nil
+		}
+		return nil
+	}
+	listener := api.redirectListener
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", api.TLS.RedirectAddr); err != nil {
+			return fmt.Errorf("redirect listener: %w", err)
+		}
+		api.redirectListener = listener
+	}
+	api.redirectServer = &http.Server{
+		Addr:              api.TLS.RedirectAddr,
+		Handler:           api.redirectHandler(api.redirectPort(listeners)),
+		ReadHeaderTimeout: api.ReadHeaderTimeout,
+		MaxHeaderBytes:    api.MaxHeaderBytes,
+		ReadTimeout:       api.ReadTimeout,
+		WriteTimeout:      api.WriteTimeout,
+		IdleTimeout:       api.IdleTimeout,
+		ErrorLog:          api.Logger,
+	}
+	api.Logger.Printf("Redirecting HTTP requests at %v to HTTPS", listener.Addr())
+	go func() {
+		if err := api.redirectServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			api.Logger.Printf("Error serving redirects %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing the certificates of the TLS tests.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    []byte
+	pool   *x509.CertPool
+	serial int64
+}
+
+// newTestCA creates a self-signed certificate authority.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pool: pool, serial: 1}
+}
+
+// issue returns the PEM certificate and key of a leaf certificate for the common name,
+// usable by a server on 127.0.0.1 or by a client depending on usage.
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM []byte, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(ca.serial),
+		Subject:        pkix.Name{CommonName: commonName},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{usage},
+		IPAddresses:    []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:       []string{commonName},
+		EmailAddresses: []string{commonName + "@example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// keyPair returns a tls.Certificate for the common name.
+func (ca *testCA) keyPair(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, commonName, usage)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeFiles writes the PEM certificate and key of a server certificate to cert.pem and key.pem in dir,
+// setting their modification time to modTime.
+func (ca *testCA) writeFiles(t *testing.T, dir string, commonName string, modTime time.Time) (certFile string, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, commonName, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for file, content := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(file, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// tlsClient returns a client trusting the CA and presenting the certificates, without connection reuse.
+func tlsClient(ca *testCA, certificates ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool, Certificates: certificates},
+		DisableKeepAlives: true,
+	}}
+}
+
+// startTLSServer starts the server with a /whoami route and returns its HTTPS base URL.
+func startTLSServer(t *testing.T, opts *OptionalParams) (*MyAPIServer, string) {
+	t.Helper()
+	api := newTestServer(t, opts)
+	api.GetN("/whoami", func(ctx ContextHandler) {
+		identity, ok := ctx.ClientIdentity()
+		if !ok {
+			ctx.Writer.Write([]byte("anonymous"))
+			return
+		}
+		ctx.Writer.Write([]byte(identity.CommonName + " " + strings.Join(identity.EmailAddresses, ",")))
+	})
+	return api, strings.Replace(startTestServer(t, api), "http://", "https://", 1)
+}
+
+// serverCommonName returns the common name of the certificate the server presents.
+func serverCommonName(t *testing.T, client *http.Client, baseURL string) string {
+	t.Helper()
+	resp, err := client.Get(baseURL + "/whoami")
+	if err != nil {
+		t.Fatalf("GET /whoami: %v", err)
+	}
+	resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestTLSCertificateFiles(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Minute)
+	certFile, keyFile := ca.writeFiles(t, dir, "first", modTime)
+	api, baseURL := startTLSServer(t, &OptionalParams{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile, ReloadInterval: -1}})
+	client := tlsClient(ca)
+
+	if cn := serverCommonName(t, client, baseURL); cn != "first" {
+		t.Fatalf("certificate = %s, want first", cn)
+	}
+	if api.TLSConfig().MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", api.TLSConfig().MinVersion)
+	}
+
+	// Unchanged files are not reloaded
+	if err := api.ReloadCertificate(); err != nil {
+		t.Fatalf("ReloadCertificate: %v", err)
+	}
+
+	// A broken key keeps the current certificate
+	os.WriteFile(keyFile, []byte("broken"), 0o600)
+	os.Chtimes(keyFile, modTime.Add(time.Second), modTime.Add(time.Second))
+	if err := api.ReloadCertificate(); err == nil {
+		t.Error("ReloadCertificate with a broken key = nil, want an error")
+	}
+	if cn := serverCommonName(t, client, baseURL); cn != "first" {
+		t.Errorf("certificate after a failed reload = %s, want first", cn)
+	}
+
+	ca.writeFiles(t, dir, "second", modTime.Add(2*time.Second))
+	if err := api.ReloadCertificate(); err != nil {
+		t.Fatalf("ReloadCertificate: %v", err)
+	}
+	if cn := serverCommonName(t, client, baseURL); cn != "second" {
+		t.Errorf("certificate after reload = %s, want second", cn)
+	}
+}
+
+func TestTLSCertificateWatch(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Minute)
+	certFile, keyFile := ca.writeFiles(t, dir, "first", modTime)
+	_, baseURL := startTLSServer(t, &OptionalParams{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 10 * time.Millisecond}})
+	client := tlsClient(ca)
+	if cn := serverCommonName(t, client, baseURL); cn != "first" {
+		t.Fatalf("certificate = %s, want first", cn)
+	}
+
+	ca.writeFiles(t, dir, "second", modTime.Add(time.Second))
+	deadline := time.Now().Add(5 * time.Second)
+	for serverCommonName(t, client, baseURL) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate not reloaded after the files changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	serverCert := ca.keyPair(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert := ca.keyPair(t, "alice", x509.ExtKeyUsageClientAuth)
+	untrustedCert := otherCA.keyPair(t, "mallory", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name       string
+		options    TLSOptions
+		clientCert []tls.Certificate
+		want       string
+		wantErr    bool
+	}{
+		{name: "CA file requires a certificate", options: TLSOptions{ClientCAFile: caFile}, clientCert: []tls.Certificate{clientCert}, want: "alice alice@example.com"},
+		{name: "CA pool", options: TLSOptions{ClientCAs: ca.pool}, clientCert: []tls.Certificate{clientCert}, want: "alice alice@example.com"},
+		{name: "missing certificate", options: TLSOptions{ClientCAFile: caFile}, wantErr: true},
+		{name: "untrusted certificate", options: TLSOptions{ClientCAFile: caFile}, clientCert: []tls.Certificate{untrustedCert}, wantErr: true},
+		{name: "optional certificate given", options: TLSOptions{ClientCAs: ca.pool, ClientAuth: tls.VerifyClientCertIfGiven}, clientCert: []tls.Certificate{clientCert}, want: "alice alice@example.com"},
+		{name: "optional certificate missing", options: TLSOptions{ClientCAs: ca.pool, ClientAuth: tls.VerifyClientCertIfGiven}, want: "anonymous"},
+		{name: "no client authentication", options: TLSOptions{}, clientCert: []tls.Certificate{clientCert}, want: "anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			options.Config = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+			_, baseURL := startTLSServer(t, &OptionalParams{TLS: options})
+
+			resp, err := tlsClient(ca, tt.clientCert...).Get(baseURL + "/whoami")
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("request succeeded, want a handshake failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != tt.want {
+				t.Errorf("identity = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIdentityFingerprint(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.keyPair(t, "alice", x509.ExtKeyUsageClientAuth)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, ok := RequestClientIdentity(r); ok {
+		t.Error("identity found on a plain HTTP request")
+	}
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	if _, ok := RequestClientIdentity(r); ok {
+		t.Error("identity found for an unverified certificate")
+	}
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{leaf, ca.cert}}
+	identity, ok := RequestClientIdentity(r)
+	if !ok || identity.CommonName != "alice" || len(identity.Fingerprint) != 64 || identity.DNSNames[0] != "alice" {
+		t.Errorf("identity = %+v, %v", identity, ok)
+	}
+}
+
+func TestTLSOptionsErrors(t *testing.T) {
+	dir := t.TempDir()
+	brokenCA := filepath.Join(dir, "ca.pem")
+	os.WriteFile(brokenCA, []byte("not a certificate"), 0o600)
+	certificate := testCertificate(t)
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+	}{
+		{name: "missing files", options: TLSOptions{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}},
+		{name: "key without certificate", options: TLSOptions{KeyFile: filepath.Join(dir, "key.pem")}},
+		{name: "missing CA file", options: TLSOptions{Config: &tls.Config{Certificates: []tls.Certificate{certificate}}, ClientCAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "CA file without certificates", options: TLSOptions{Config: &tls.Config{Certificates: []tls.Certificate{certificate}}, ClientCAFile: brokenCA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, &OptionalParams{TLS: tt.options})
+			if err := api.Validate(); !errors.Is(err, ErrInvalidTLS) {
+				t.Errorf("Validate = %v, want ErrInvalidTLS", err)
+			}
+		})
+	}
+
+	api := newTestServer(t, nil)
+	if err := api.ReloadCertificate(); !errors.Is(err, ErrInvalidTLS) {
+		t.Errorf("ReloadCertificate without files = %v, want ErrInvalidTLS", err)
+	}
+	if api.TLSConfig() != nil {
+		t.Error("TLSConfig set without TLS options")
+	}
+}
+
+func TestTLSRedirect(t *testing.T) {
+	tests := []struct {
+		addr     string
+		port     string
+		target   string
+		noHost   bool
+		wantCode int
+		want     string
+	}{
+		{port: "8443", target: "http://example.com/a?b=c", want: "https://example.com:8443/a?b=c"},
+		{port: "443", target: "http://example.com:80/a", want: "https://example.com/a"},
+		{port: "", target: "http://example.com:80/a", want: "https://example.com/a"},
+		{port: "8443", target: "http://[::1]:8080/", want: "https://[::1]:8443/"},
+		{addr: "api.example.com:8443", port: "8443", target: "/a", noHost: true, want: "https://api.example.com:8443/a"},
+		{addr: ":8443", port: "8443", target: "/a", noHost: true, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		api := newTestServer(t, &OptionalParams{Addr: tt.addr})
+		r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		if tt.noHost {
+			r.Host = ""
+		}
+		w := httptest.NewRecorder()
+		api.redirectHandler(tt.port).ServeHTTP(w, r)
+		wantCode := tt.wantCode
+		if wantCode == 0 {
+			wantCode = http.StatusPermanentRedirect
+		}
+		if w.Code != wantCode || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s to port %q: %d %q, want %d %q", tt.target, tt.port, w.Code, w.Header().Get("Location"), wantCode, tt.want)
+		}
+	}
+
+	// Without TCP listeners, the port of Addr is used
+	api := newTestServer(t, &OptionalParams{Addr: ":8443"})
+	if port := api.redirectPort(nil); port != "8443" {
+		t.Errorf("redirectPort = %q, want 8443", port)
+	}
+}
+
+func TestTLSRedirectListener(t *testing.T) {
+	certificate := testCertificate(t)
+	api, _ := startTLSServer(t, &OptionalParams{TLS: TLSOptions{
+		Config:       &tls.Config{Certificates: []tls.Certificate{certificate}},
+		RedirectAddr: "127.0.0.1:0",
+	}})
+	_, port, _ := net.SplitHostPort(api.ListenAddr().String())
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get("http://" + api.redirectListener.Addr().String() + "/whoami?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want := "https://127.0.0.1:" + port + "/whoami?x=1"; resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != want {
+		t.Errorf("redirect = %d %q, want 308 %q", resp.StatusCode, resp.Header.Get("Location"), want)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ValidatorFunc checks a field value against a validation rule.
+// The value is never a pointer: nil pointers are only checked by the required rule.
+// The param is the text following the equal sign of the rule, e.g. "3" for min=3.
+type ValidatorFunc func(value reflect.Value, param string) bool
+
+// FieldError describes a struct field that failed a validation rule.
+type FieldError struct {
+	// Field is the path of the field, using JSON names, e.g. "address.city" or "items[2].sku".
+	Field string `json:"field"`
+
+	// Rule is the name of the rule that failed, e.g. "min".
+	Rule string `json:"rule"`
+
+	// Param is the parameter of the rule, e.g. "3" for min=3.
+	Param string `json:"param,omitempty"`
+
+	// Message is a human readable description of the failure.
+	Message string `json:"message"`
+}
+
+// Error returns a description of the field failure.
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationErrors is the list of field failures returned by the validation methods.
+type ValidationErrors []FieldError
+
+// Error returns the field failures separated by semicolons.
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// StatusCode returns the HTTP status code matching the error, 422 Unprocessable Entity.
+func (e ValidationErrors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// builtinValidators contains the rules available to every server.
+var builtinValidators = map[string]ValidatorFunc{
+	"min":      func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c >= 0 }) },
+	"max":      func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c <= 0 }) },
+	"len":      func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c == 0 }) },
+	"eq":       validateEqual,
+	"ne":       func(v reflect.Value, p string) bool { return !validateEqual(v, p) },
+	"gt":       func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c > 0 }) },
+	"gte":      func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c >= 0 }) },
+	"lt":       func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c < 0 }) },
+	"lte":      func(v reflect.Value, p string) bool { return compareRule(v, p, func(c int) bool { return c <= 0 }) },
+	"oneof":    validateOneOf,
+	"email":    validateEmail,
+	"url":      validateURL,
+	"uuid":     func(v reflect.Value, _ string) bool { return v.Kind() == reflect.String && isUUID(v.String()) },
+	"alpha":    func(v reflect.Value, _ string) bool { return stringOf(v, unicode.IsLetter) },
+	"alphanum": func(v reflect.Value, _ string) bool { return stringOf(v, isAlphaNum) },
+	"numeric":  func(v reflect.Value, _ string) bool { return stringOf(v, unicode.IsDigit) },
+}
+
+// validationMessages contains the message format of the built-in rules; %s is replaced by the rule parameter.
+var validationMessages = map[string]string{
+	"required": "is required",
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"len":      "must have a length of %s",
+	"eq":       "must be equal to %s",
+	"ne":       "must not be equal to %s",
+	"gt":       "must be greater than %s",
+	"gte":      "must be greater than or equal to %s",
+	"lt":       "must be less than %s",
+	"lte":      "must be less than or equal to %s",
+	"oneof":    "must be one of [%s]",
+	"email":    "must be a valid email address",
+	"url":      "must be a valid URL",
+	"uuid":     "must be a valid UUID",
+	"alpha":    "must only contain letters",
+	"alphanum": "must only contain letters and digits",
+	"numeric":  "must only contain digits",
+}
+
+// RegisterValidator registers a custom validation rule usable in `validate` tags under the given name.
+// A custom rule replaces a built-in rule with the same name.
+func (api *MyAPIServer) RegisterValidator(name string, validator ValidatorFunc) {
+	if api.validators == nil {
+		api.validators = make(map[string]ValidatorFunc)
+	}
+	api.validators[name] = validator
+}
+
+// ValidateStruct checks the fields of the struct pointed to by v against their `validate` tags.
+// It returns ValidationErrors listing every failing field, or another error if a tag uses an unknown rule.
+//
+// Rules are separated by commas and take an optional parameter after an equal sign, e.g.
+// `validate:"required,min=3,max=20"`. The omitempty rule skips the other rules when the field is empty.
+// Nested structs, pointers to structs and slices of structs are validated recursively.
+func (api *MyAPIServer) ValidateStruct(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	var errs ValidationErrors
+	if err := api.validateStruct(value, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the struct pointed to by v against its `validate` tags,
+// using the custom rules registered on the server.
+func (ctx *ContextHandler) Validate(v interface{}) error {
+	api := ctx.api
+	if api == nil {
+		api = &MyAPIServer{}
+	}
+	return api.ValidateStruct(v)
+}
+
+// BindAndValidate binds the request into v with Bind and validates it with Validate.
+// On failure it writes the error response itself with ctx.Error and returns the error, so the handler
+// only has to return: with the default error renderer, binding failures are answered with 400 Bad Request
+// (413 for bodies over the size limit, 415 for unsupported content types) and validation failures with a
+// 422 Unprocessable Entity application/problem+json response listing the failing fields.
+func (ctx *ContextHandler) BindAndValidate(v interface{}) error {
+	err := ctx.Bind(v)
+	if err == nil {
+		err = ctx.Validate(v)
+	}
+	if err != nil {
+		ctx.Error(err)
+	}
+	return err
+}
+
+// validateStruct checks every field of the struct value, appending failures to errs.
+// Like encoding/json, the exported fields promoted through unexported embedded structs are checked too.
+func (api *MyAPIServer) validateStruct(value reflect.Value, path string, errs *ValidationErrors) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+		if !field.IsExported() {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if field.Anonymous && embedded.Kind() == reflect.Struct {
+				if err := api.validateNested(fieldValue, path, errs); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// Embedded structs keep the path of the outer struct
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinFieldPath(path, jsonFieldName(field))
+		}
+
+		if err := api.validateField(fieldValue, field.Tag.Get("validate"), fieldPath, errs); err != nil {
+			return err
+		}
+		if err := api.validateNested(fieldValue, fieldPath, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates structs reachable from the field: structs, pointers to structs and slices of them.
+func (api *MyAPIServer) validateNested(value reflect.Value, path string, errs *ValidationErrors) error {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == timeType {
+			return nil
+		}
+		return api.validateStruct(value, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := api.validateNested(value.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField checks the field value against the rules of its validate tag.
+// Only the first failing rule of a field is reported.
+func (api *MyAPIServer) validateField(value reflect.Value, tag string, path string, errs *ValidationErrors) error {
+	if tag == "" || tag == "-" {
+		return nil
+	}
+	rules := strings.Split(tag, ",")
+
+	// Empty values are only checked by required, and skip every rule with omitempty
+	empty := isEmptyValue(value)
+	for _, rule := range rules {
+		switch {
+		case rule == "required" && empty:
+			*errs = append(*errs, newFieldError(path, "required", ""))
+			return nil
+		case rule == "omitempty" && empty:
+			return nil
+		}
+	}
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		if name == "required" || name == "omitempty" {
+			continue
+		}
+		validator, ok := api.validators[name]
+		if !ok {
+			validator, ok = builtinValidators[name]
+		}
+		if !ok {
+			return fmt.Errorf("unknown validation rule %q on field %s", name, path)
+		}
+		if !validator(value, param) {
+			*errs = append(*errs, newFieldError(path, name, param))
+			return nil
+		}
+	}
+	return nil
+}
+
+// newFieldError creates a FieldError with the message of the rule.
+func newFieldError(path string, rule string, param string) FieldError {
+	message := "failed the " + rule + " validation"
+	if format, ok := validationMessages[rule]; ok {
+		message = format
+		if strings.Contains(format, "%s") {
+			message = fmt.Sprintf(format, param)
+		}
+	}
+	return FieldError{Field: path, Rule: rule, Param: param, Message: message}
+}
+
+// compareRule compares the value, or its length for strings, slices and maps, with the numeric parameter
+// and passes the comparison result (-1, 0 or 1) to check.
+func compareRule(value reflect.Value, param string, check func(int) bool) bool {
+	switch value.Kind() {
+	case reflect.String:
+		n, err := strconv.Atoi(param)
+		return err == nil && check(compareNumbers(float64(utf8.RuneCountInString(value.String())), float64(n)))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.Atoi(param)
+		return err == nil && check(compareNumbers(float64(value.Len()), float64(n)))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(param, 10, 64)
+		return err == nil && check(compareNumbers(float64(value.Int()), float64(n)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(param, 10, 64)
+		return err == nil && check(compareNumbers(float64(value.Uint()), float64(n)))
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(param, 64)
+		return err == nil && check(compareNumbers(value.Float(), n))
+	}
+	return false
+}
+
+// compareNumbers returns -1, 0 or 1 depending on whether a is less than, equal to or greater than b.
+func compareNumbers(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// validateEqual checks that a string is equal to the parameter, or that any other value compares equal to it.
+func validateEqual(value reflect.Value, param string) bool {
+	if value.Kind() == reflect.String {
+		return value.String() == param
+	}
+	return compareRule(value, param, func(c int) bool { return c == 0 })
+}
+
+// validateOneOf checks that the value, formatted as text, is one of the space separated options.
+func validateOneOf(value reflect.Value, param string) bool {
+	text := fmt.Sprint(value.Interface())
+	for _, option := range strings.Fields(param) {
+		if text == option {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEmail checks that the value is a bare email address such as user@example.com.
+func validateEmail(value reflect.Value, _ string) bool {
+	if value.Kind() != reflect.String {
+		return false
+	}
+	address, err := mail.ParseAddress(value.String())
+	return err == nil && address.Address == value.String()
+}
+
+// validateURL checks that the value is an absolute URL with a scheme and a host.
+func validateURL(value reflect.Value, _ string) bool {
+	if value.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.Parse(value.String())
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// stringOf checks that the value is a non-empty string whose characters all satisfy the predicate.
+func stringOf(value reflect.Value, predicate func(rune) bool) bool {
+	if value.Kind() != reflect.String || value.String() == "" {
+		return false
+	}
+	for _, c := range value.String() {
+		if !predicate(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlphaNum reports whether the character is a letter or a digit.
+func isAlphaNum(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// isEmptyValue reports whether the value is the zero value, or an empty slice or map.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// jsonFieldName returns the name of the field in its JSON representation.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// joinFieldPath appends the field name to the path of its parent struct.
+func joinFieldPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
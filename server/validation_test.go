@@ -0,0 +1,277 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateStructRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         interface{}
+		wantRules []string
+	}{
+		{name: "required string", v: &struct {
+			Name string `validate:"required"`
+		}{}, wantRules: []string{"required"}},
+		{name: "required nil pointer", v: &struct {
+			Age *int `validate:"required,min=1"`
+		}{}, wantRules: []string{"required"}},
+		{name: "omitempty", v: &struct {
+			Email string `validate:"omitempty,email"`
+		}{}},
+		{name: "min length", v: &struct {
+			Name string `validate:"min=3"`
+		}{Name: "ab"}, wantRules: []string{"min"}},
+		{name: "max number", v: &struct {
+			Age int `validate:"max=120"`
+		}{Age: 121}, wantRules: []string{"max"}},
+		{name: "len slice", v: &struct {
+			Tags []string `validate:"len=2"`
+		}{Tags: []string{"a"}}, wantRules: []string{"len"}},
+		{name: "gt lt", v: &struct {
+			A float64 `validate:"gt=0"`
+			B uint    `validate:"lt=10"`
+		}{A: 0, B: 10}, wantRules: []string{"gt", "lt"}},
+		{name: "eq ne", v: &struct {
+			A string `validate:"eq=yes"`
+			B int    `validate:"ne=0"`
+		}{A: "no", B: 1}, wantRules: []string{"eq"}},
+		{name: "oneof", v: &struct {
+			Color string `validate:"oneof=red green"`
+			Size  int    `validate:"oneof=1 2 3"`
+		}{Color: "blue", Size: 2}, wantRules: []string{"oneof"}},
+		{name: "email url uuid", v: &struct {
+			Email string `validate:"email"`
+			Site  string `validate:"url"`
+			ID    string `validate:"uuid"`
+		}{Email: "Bob <bob@example.com>", Site: "example.com", ID: "3f2504e0-4f89-11d3-9a0c-0305e82c3301"}, wantRules: []string{"email", "url"}},
+		{name: "character classes", v: &struct {
+			A string `validate:"alpha"`
+			B string `validate:"alphanum"`
+			C string `validate:"numeric"`
+		}{A: "abc1", B: "abc1", C: "12.5"}, wantRules: []string{"alpha", "numeric"}},
+		{name: "first failing rule only", v: &struct {
+			Name string `validate:"min=5,alpha"`
+		}{Name: "ab1"}, wantRules: []string{"min"}},
+		{name: "valid", v: &struct {
+			Name  string   `validate:"required,min=3,max=10,alpha"`
+			Email string   `validate:"required,email"`
+			Site  string   `validate:"url"`
+			Tags  []string `validate:"min=1"`
+		}{Name: "alice", Email: "alice@example.com", Site: "https://example.com/a", Tags: []string{"x"}}},
+	}
+	api := &MyAPIServer{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := api.ValidateStruct(tt.v)
+			var rules []string
+			var errs ValidationErrors
+			if errors.As(err, &errs) {
+				for _, fieldErr := range errs {
+					rules = append(rules, fieldErr.Rule)
+				}
+			} else if err != nil {
+				t.Fatalf("ValidateStruct = %v", err)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("failed rules = %v, want %v (%v)", rules, tt.wantRules, err)
+			}
+		})
+	}
+}
+
+// orderRequest is a nested validation target.
+type orderRequest struct {
+	Customer struct {
+		Email string `json:"email" validate:"required,email"`
+	} `json:"customer"`
+	Shipping *shippingAddress `json:"shipping"`
+	Items    []orderItem      `json:"items" validate:"min=1"`
+}
+
+type shippingAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type orderItem struct {
+	SKU      string `json:"sku" validate:"required,alphanum"`
+	Quantity int    `json:"qty" validate:"gte=1"`
+}
+
+func TestValidateStructPaths(t *testing.T) {
+	v := orderRequest{Shipping: &shippingAddress{}, Items: []orderItem{{SKU: "a1", Quantity: 1}, {SKU: "b-2", Quantity: 0}}}
+	err := (&MyAPIServer{}).ValidateStruct(&v)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ValidateStruct = %v, want ValidationErrors", err)
+	}
+	want := ValidationErrors{
+		{Field: "customer.email", Rule: "required", Message: "is required"},
+		{Field: "shipping.city", Rule: "required", Message: "is required"},
+		{Field: "items[1].sku", Rule: "alphanum", Message: "must only contain letters and digits"},
+		{Field: "items[1].qty", Rule: "gte", Param: "1", Message: "must be greater than or equal to 1"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %+v\nwant %+v", errs, want)
+	}
+	if errs.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("StatusCode = %d, want 422", errs.StatusCode())
+	}
+}
+
+// auditFields is embedded unexported: its exported fields are promoted and validated.
+type auditFields struct {
+	CreatedBy string `json:"created_by" validate:"required"`
+}
+
+// Timestamps is embedded exported.
+type Timestamps struct {
+	Version int `json:"version" validate:"gte=1"`
+}
+
+func TestValidateStructEmbedded(t *testing.T) {
+	type record struct {
+		auditFields
+		*shippingAddress
+		Timestamps
+		secret string `validate:"required"`
+	}
+	tests := []struct {
+		name string
+		v    record
+		want []string
+	}{
+		{name: "valid", v: record{auditFields: auditFields{CreatedBy: "ops"}, Timestamps: Timestamps{Version: 1}}},
+		{name: "promoted fields", v: record{}, want: []string{"created_by", "version"}},
+		{name: "embedded pointer", v: record{auditFields: auditFields{CreatedBy: "ops"}, shippingAddress: &shippingAddress{}, Timestamps: Timestamps{Version: 1}}, want: []string{"city"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&MyAPIServer{}).ValidateStruct(&tt.v)
+			var errs ValidationErrors
+			if err != nil && !errors.As(err, &errs) {
+				t.Fatalf("ValidateStruct = %v, want ValidationErrors", err)
+			}
+			var fields []string
+			for _, fieldErr := range errs {
+				fields = append(fields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("failing fields = %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	api := newTestServer(t, nil)
+	api.RegisterValidator("even", func(value reflect.Value, _ string) bool {
+		return value.CanInt() && value.Int()%2 == 0
+	})
+	// A custom rule replaces the built-in rule with the same name
+	api.RegisterValidator("email", func(value reflect.Value, _ string) bool {
+		return strings.HasSuffix(value.String(), "@example.com")
+	})
+
+	tests := []struct {
+		name     string
+		v        interface{}
+		wantRule string
+		wantErr  bool
+	}{
+		{name: "custom rule", v: &struct {
+			N int `validate:"even"`
+		}{N: 3}, wantRule: "even"},
+		{name: "custom rule passes", v: &struct {
+			N int `validate:"even"`
+		}{N: 4}},
+		{name: "replaced built-in", v: &struct {
+			Email string `validate:"email"`
+		}{Email: "bob@example.org"}, wantRule: "email"},
+		{name: "unknown rule", v: &struct {
+			N int `validate:"odd"`
+		}{N: 3}, wantErr: true},
+		{name: "not a struct", v: new(int), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := api.ValidateStruct(tt.v)
+			var errs ValidationErrors
+			switch {
+			case tt.wantErr:
+				if err == nil || errors.As(err, &errs) {
+					t.Errorf("ValidateStruct = %v, want a non-validation error", err)
+				}
+			case tt.wantRule == "":
+				if err != nil {
+					t.Errorf("ValidateStruct = %v, want nil", err)
+				}
+			case !errors.As(err, &errs) || errs[0].Rule != tt.wantRule:
+				t.Errorf("ValidateStruct = %v, want a %s failure", err, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestBindAndValidate(t *testing.T) {
+	type signup struct {
+		Name  string `json:"name" form:"name" validate:"required,min=3"`
+		Email string `json:"email" form:"email" validate:"required,email"`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantFields  []string
+	}{
+		{name: "valid json", contentType: "application/json", body: `{"name":"alice","email":"alice@example.com"}`, wantStatus: http.StatusCreated},
+		{name: "valid form", contentType: "application/x-www-form-urlencoded", body: "name=alice&email=alice@example.com", wantStatus: http.StatusCreated},
+		{name: "invalid fields", contentType: "application/json", body: `{"name":"al"}`, wantStatus: http.StatusUnprocessableEntity, wantFields: []string{"name", "email"}},
+		{name: "syntax error", contentType: "application/json", body: `{"name":`, wantStatus: http.StatusBadRequest},
+		{name: "unsupported media type", contentType: "text/plain", body: "alice", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			api.PostN("/signup", func(ctx ContextHandler) {
+				var v signup
+				if err := ctx.BindAndValidate(&v); err != nil {
+					return
+				}
+				ctx.Writer.WriteHeader(http.StatusCreated)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			api.ServMConfigure(nil).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusCreated {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/problem+json") {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+			var problem HTTPError
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			var fields []string
+			for _, field := range problem.Fields {
+				fields = append(fields, field.Field)
+			}
+			if problem.Status != tt.wantStatus || !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("problem = %+v, want status %d and fields %v", problem, tt.wantStatus, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,877 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, as defined by RFC 6455.
+const (
+	WSTextMessage   = 1
+	WSBinaryMessage = 2
+	WSCloseMessage  = 8
+	WSPingMessage   = 9
+	WSPongMessage   = 10
+)
+
+// WebSocket close codes, as defined by RFC 6455 and the IANA registry.
+const (
+	WSCloseNormal             = 1000
+	WSCloseGoingAway          = 1001
+	WSCloseProtocolError      = 1002
+	WSCloseUnsupportedData    = 1003
+	WSCloseNoStatus           = 1005
+	WSCloseAbnormal           = 1006
+	WSCloseInvalidPayload     = 1007
+	WSClosePolicyViolation    = 1008
+	WSCloseMessageTooBig      = 1009
+	WSCloseMandatoryExtension = 1010
+	WSCloseInternalError      = 1011
+	WSCloseServiceRestart     = 1012
+	WSCloseTryAgainLater      = 1013
+)
+
+// Defaults of the WebSocket options.
+const (
+	DefaultWSReadLimit    = 1 << 20
+	DefaultWSPingInterval = 30 * time.Second
+	DefaultWSWriteTimeout = 10 * time.Second
+	DefaultWSCloseTimeout = 5 * time.Second
+)
+
+// wsGUID is the GUID appended to the client key to compute Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsFragmentSize is the size of the frames written by the writers returned by NextWriter.
+const wsFragmentSize = 32 << 10
+
+// wsCompressThreshold is the size under which messages are sent uncompressed even when compression is negotiated.
+const wsCompressThreshold = 128
+
+// wsDeflateTail terminates a compressed message so that the flate reader ends cleanly.
+var wsDeflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+var (
+	// ErrWSClosed is returned when writing to a WebSocket connection after the closing handshake started.
+	ErrWSClosed = errors.New("websocket connection closed")
+
+	// ErrWSMessageType is returned when writing a message with a type other than text or binary.
+	ErrWSMessageType = errors.New("invalid websocket message type")
+
+	// ErrWSControlTooLarge is returned when sending a ping or pong with a payload of more than 125 bytes.
+	ErrWSControlTooLarge = errors.New("websocket control frame payload larger than 125 bytes")
+)
+
+// WSOptions configures the WebSocket endpoints of a server.
+type WSOptions struct {
+	// AllowedOrigins lists the origins allowed to open WebSocket connections from a browser, besides the server's own.
+	// Entries are full origins ("https://app.example.com"), hosts ("app.example.com"), host wildcards
+	// ("*.example.com") or "*" for any origin. Hosts and host wildcards without a port match any port.
+	// Requests without an Origin header are always allowed.
+	AllowedOrigins []string
+
+	// CheckOrigin replaces the AllowedOrigins check when set.
+	CheckOrigin func(r *http.Request) bool
+
+	// Subprotocols lists the subprotocols supported by the server, in order of preference.
+	Subprotocols []string
+
+	// EnableCompression negotiates the permessage-deflate extension with the clients offering it.
+	EnableCompression bool
+
+	// ReadLimit is the maximum size of a received message in bytes (1 MB when 0, unlimited when negative).
+	ReadLimit int64
+
+	// PingInterval is the interval between the keepalive pings (30s when 0, disabled when negative).
+	// Connections that stay silent for two intervals are closed.
+	PingInterval time.Duration
+
+	// WriteTimeout is the maximum duration of a write (10s when 0, unlimited when negative).
+	WriteTimeout time.Duration
+
+	// CloseTimeout is how long the server waits for the client to answer the closing handshake (5s when 0).
+	CloseTimeout time.Duration
+}
+
+// WSCloseError is returned by ReadMessage once the connection is closed, with the code and reason that closed it.
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error returns the close code and reason.
+func (e *WSCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed: %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// WSConn is an open WebSocket connection. A single goroutine may read from it at a time,
+// while writes are safe for concurrent use. Control frames (pings and the closing handshake)
+// are answered while reading, so handlers should keep calling ReadMessage until it fails.
+type WSConn struct {
+	// Request is the upgraded HTTP request; path parameters are available through Request.PathValue.
+	Request *http.Request
+
+	conn        net.Conn
+	reader      *bufio.Reader
+	options     WSOptions
+	subprotocol string
+	compress    bool
+
+	// messageMu serialises data messages while writeMu serialises frames, so that control frames
+	// can be sent between the fragments of a message.
+	messageMu sync.Mutex
+	writeMu   sync.Mutex
+
+	// stateMu guards the closing handshake state.
+	stateMu       sync.Mutex
+	closeSent     bool
+	closeDeadline time.Time
+	readErr       error
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// wsFrame is a frame read from the connection.
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+// WebSocket registers a WebSocket endpoint for GET requests on the specified URL pattern.
+// The handshake is checked and answered by the server, then the handler runs with the connection,
+// which is closed when the handler returns. The optional middlewares run before the handshake.
+func (api *MyAPIServer) WebSocket(pattern string, myHandler func(conn *WSConn), middlewares ...Middleware) {
+	api.register(http.MethodGet, pattern, api.websocketHandler(myHandler), convertMiddlewares(middlewares))
+}
+
+// WebSocketN registers a WebSocket endpoint like WebSocket, with ContextHandler middlewares.
+func (api *MyAPIServer) WebSocketN(pattern string, myHandler func(conn *WSConn), middlewares ...MiddlewareN) {
+	api.register(http.MethodGet, pattern, api.websocketHandler(myHandler), api.convertMiddlewaresN(middlewares))
+}
+
+// websocketHandler upgrades the requests to WebSocket connections and runs the handler with them.
+func (api *MyAPIServer) websocketHandler(handler func(conn *WSConn)) http.Handler {
+	if handler == nil {
+		return nil
+	}
+	return api.handlerWrapper(func(ctx ContextHandler) {
+		hub := api.WSHub()
+		if hub.isClosed() {
+			ctx.Error(NewHTTPError(http.StatusServiceUnavailable, "server shutting down"))
+			return
+		}
+		conn, err := ctx.upgradeWebSocket(api.WebSocketOptions)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		hub.Register(conn)
+		defer hub.Unregister(conn)
+		defer conn.finish()
+
+		// The response can no longer be written: report panics by closing the connection
+		defer func() {
+			if r := recover(); r != nil {
+				ctx.logf("websocket %s panic: %v", ctx.Request.URL.Path, r)
+				conn.Close(WSCloseInternalError, "")
+			}
+		}()
+		handler(conn)
+	})
+}
+
+// upgradeWebSocket checks the WebSocket handshake, takes over the connection and sends the 101 response.
+func (ctx *ContextHandler) upgradeWebSocket(options WSOptions) (*WSConn, error) {
+	r := ctx.Request
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, NewHTTPError(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Writer.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, NewHTTPError(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if !options.checkOrigin(r) {
+		return nil, NewHTTPError(http.StatusForbidden, "origin not allowed")
+	}
+
+	subprotocol := options.selectSubprotocol(r)
+	compress := options.EnableCompression && acceptsDeflate(r.Header)
+
+	netConn, brw, err := http.NewResponseController(ctx.Writer).Hijack()
+	if err != nil {
+		return nil, &HTTPError{Status: http.StatusInternalServerError, Err: fmt.Errorf("websocket upgrade: %w", err)}
+	}
+	if rw, ok := ctx.Writer.(*responseWriter); ok {
+		rw.status = http.StatusSwitchingProtocols
+	}
+
+	// The server deadlines still apply to the hijacked connection
+	netConn.SetDeadline(time.Time{})
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	b.WriteString("\r\n")
+	if options.WriteTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(options.WriteTimeout))
+	}
+	if _, err = brw.WriteString(b.String()); err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	conn := &WSConn{
+		Request:     r,
+		conn:        netConn,
+		reader:      brw.Reader,
+		options:     options,
+		subprotocol: subprotocol,
+		compress:    compress,
+		done:        make(chan struct{}),
+	}
+	if options.PingInterval > 0 {
+		go conn.keepalive()
+	}
+	return conn, nil
+}
+
+// wsAcceptKey returns the Sec-WebSocket-Accept value for the client key.
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether the comma-separated header contains the token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkOrigin reports whether the request comes from an allowed origin.
+func (options WSOptions) checkOrigin(r *http.Request) bool {
+	if options.CheckOrigin != nil {
+		return options.CheckOrigin(r)
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range options.AllowedOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case strings.Contains(allowed, "://"):
+			if strings.EqualFold(allowed, origin) {
+				return true
+			}
+		case matchOriginHost(allowed, u):
+			return true
+		}
+	}
+	return false
+}
+
+// matchOriginHost reports whether the origin matches an AllowedOrigins entry giving a host or a host wildcard.
+// Entries without a port match the host on any port.
+func matchOriginHost(allowed string, origin *url.URL) bool {
+	host := origin.Host
+	if _, _, err := net.SplitHostPort(allowed); err != nil {
+		host = origin.Hostname()
+		allowed = strings.Trim(allowed, "[]")
+	}
+	allowed, host = strings.ToLower(allowed), strings.ToLower(host)
+	if strings.HasPrefix(allowed, "*.") {
+		return strings.HasSuffix(host, allowed[1:])
+	}
+	return host == allowed
+}
+
+// selectSubprotocol returns the first subprotocol of the server requested by the client, or an empty string.
+func (options WSOptions) selectSubprotocol(r *http.Request) string {
+	for _, supported := range options.Subprotocols {
+		if headerContainsToken(r.Header, "Sec-WebSocket-Protocol", supported) {
+			return supported
+		}
+	}
+	return ""
+}
+
+// acceptsDeflate reports whether the client offers a permessage-deflate configuration the server supports.
+// The server always resets the compression context between messages and uses the full window.
+func acceptsDeflate(header http.Header) bool {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(value, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			supported := true
+			for _, param := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				switch strings.TrimSpace(name) {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					supported = supported && strings.Trim(strings.TrimSpace(value), `"`) == "15"
+				default:
+					supported = false
+				}
+			}
+			if supported {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Subprotocol returns the negotiated subprotocol, or an empty string.
+func (c *WSConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the network address of the client.
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Done returns a channel closed once the connection is closed.
+func (c *WSConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// ReadMessage reads the next text or binary message, reassembling fragmented messages and
+// answering pings and the closing handshake on the way. Text messages are checked to be valid UTF-8.
+// Once the connection is closed, it returns a *WSCloseError with the code that closed it.
+func (c *WSConn) ReadMessage() (messageType int, data []byte, err error) {
+	if err := c.readError(); err != nil {
+		return 0, nil, err
+	}
+
+	var buf bytes.Buffer
+	compressed := false
+	for {
+		frame, err := c.readFrame(int64(buf.Len()))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frame.opcode {
+		case WSPingMessage:
+			c.writeFrame(true, false, WSPongMessage, frame.payload)
+			continue
+		case WSPongMessage:
+			continue
+		case WSCloseMessage:
+			return 0, nil, c.closeReceivedFrame(frame.payload)
+		case WSTextMessage, WSBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, "new message before the end of the previous one")
+			}
+			messageType = frame.opcode
+			compressed = frame.rsv1
+		default:
+			if messageType == 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, "continuation frame without a message")
+			}
+		}
+		buf.Write(frame.payload)
+		if frame.fin {
+			break
+		}
+	}
+
+	data = buf.Bytes()
+	if compressed {
+		if data, err = c.inflate(data); err != nil {
+			return 0, nil, err
+		}
+	}
+	if messageType == WSTextMessage && !utf8.Valid(data) {
+		return 0, nil, c.fail(WSCloseInvalidPayload, "invalid UTF-8 in text message")
+	}
+	return messageType, data, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// readFrame reads the next frame, checking it against the protocol and the read limit.
+// received is the size of the message received so far.
+func (c *WSConn) readFrame(received int64) (*wsFrame, error) {
+	c.setReadDeadline()
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, c.readFailed(err)
+	}
+	frame := &wsFrame{
+		fin:    header[0]&0x80 != 0,
+		rsv1:   header[0]&0x40 != 0,
+		opcode: int(header[0] & 0x0f),
+	}
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	switch {
+	case header[0]&0x30 != 0:
+		return nil, c.fail(WSCloseProtocolError, "unexpected reserved bits")
+	case frame.rsv1 && (!c.compress || (frame.opcode != WSTextMessage && frame.opcode != WSBinaryMessage)):
+		return nil, c.fail(WSCloseProtocolError, "unexpected compression bit")
+	case frame.opcode >= WSCloseMessage && frame.opcode <= WSPongMessage:
+		if !frame.fin || length > 125 {
+			return nil, c.fail(WSCloseProtocolError, "invalid control frame")
+		}
+	case frame.opcode > WSBinaryMessage:
+		return nil, c.fail(WSCloseProtocolError, "unknown opcode")
+	}
+	if !masked {
+		return nil, c.fail(WSCloseProtocolError, "unmasked client frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, c.readFailed(err)
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, c.readFailed(err)
+		}
+		if ext[0]&0x80 != 0 {
+			return nil, c.fail(WSCloseProtocolError, "invalid frame length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if limit := c.options.ReadLimit; limit > 0 && frame.opcode < WSCloseMessage && received+length > limit {
+		return nil, c.fail(WSCloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return nil, c.readFailed(err)
+	}
+	// Read progressively rather than trusting the announced length for the allocation
+	payload, err := io.ReadAll(io.LimitReader(c.reader, length))
+	if err == nil && int64(len(payload)) < length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, c.readFailed(err)
+	}
+	frame.payload = payload
+	for i := range frame.payload {
+		frame.payload[i] ^= mask[i%4]
+	}
+	return frame, nil
+}
+
+// setReadDeadline sets the read deadline: the end of the closing handshake, or two ping intervals.
+func (c *WSConn) setReadDeadline() {
+	c.stateMu.Lock()
+	deadline := c.closeDeadline
+	c.stateMu.Unlock()
+	if deadline.IsZero() && c.options.PingInterval > 0 {
+		deadline = time.Now().Add(2 * c.options.PingInterval)
+	}
+	c.conn.SetReadDeadline(deadline)
+}
+
+// inflate decompresses a permessage-deflate message, enforcing the read limit.
+func (c *WSConn) inflate(data []byte) ([]byte, error) {
+	reader := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(wsDeflateTail)))
+	defer reader.Close()
+	var src io.Reader = reader
+	if c.options.ReadLimit > 0 {
+		src = io.LimitReader(reader, c.options.ReadLimit+1)
+	}
+	inflated, err := io.ReadAll(src)
+	if err != nil {
+		return nil, c.fail(WSCloseInvalidPayload, "invalid compressed message")
+	}
+	if c.options.ReadLimit > 0 && int64(len(inflated)) > c.options.ReadLimit {
+		return nil, c.fail(WSCloseMessageTooBig, "message too big")
+	}
+	return inflated, nil
+}
+
+// closeReceivedFrame completes the closing handshake started by the client.
+func (c *WSConn) closeReceivedFrame(payload []byte) error {
+	code, reason := WSCloseNoStatus, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(WSCloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(WSCloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(reason) {
+			return c.fail(WSCloseInvalidPayload, "invalid close reason")
+		}
+	}
+
+	// Echo the close code unless the server started the closing handshake
+	if code == WSCloseNoStatus {
+		c.writeClose(nil)
+	} else {
+		c.writeClose(payload[:2])
+	}
+	err := &WSCloseError{Code: code, Reason: reason}
+	c.shutdown(err)
+	return err
+}
+
+// validCloseCode reports whether the code may be sent in a close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// fail closes the connection after a protocol violation, telling the client why.
+func (c *WSConn) fail(code int, reason string) error {
+	c.writeClose(closePayload(code, reason))
+	err := &WSCloseError{Code: code, Reason: reason}
+	c.shutdown(err)
+	return err
+}
+
+// readFailed closes the connection after a read error, such as the client going away or a missed keepalive.
+func (c *WSConn) readFailed(err error) error {
+	c.stateMu.Lock()
+	closing := c.closeSent
+	c.stateMu.Unlock()
+	closeErr := &WSCloseError{Code: WSCloseAbnormal, Reason: err.Error()}
+	if closing {
+		// The client did not answer the closing handshake in time
+		closeErr = &WSCloseError{Code: WSCloseAbnormal, Reason: "closing handshake timed out"}
+	}
+	c.shutdown(closeErr)
+	return closeErr
+}
+
+// readError returns the error that closed the connection for reading, if any.
+func (c *WSConn) readError() error {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.readErr
+}
+
+// shutdown records the error ending the connection and closes the network connection.
+func (c *WSConn) shutdown(err error) {
+	c.stateMu.Lock()
+	if c.readErr == nil {
+		c.readErr = err
+	}
+	c.stateMu.Unlock()
+	c.doneOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// WriteMessage writes a text or binary message in a single frame, compressed when negotiated.
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WSTextMessage && messageType != WSBinaryMessage {
+		return ErrWSMessageType
+	}
+	c.messageMu.Lock()
+	defer c.messageMu.Unlock()
+	return c.writeData(messageType, data)
+}
+
+// WriteText writes a text message.
+func (c *WSConn) WriteText(text string) error {
+	return c.WriteMessage(WSTextMessage, []byte(text))
+}
+
+// WriteJSON writes v as a JSON text message.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(WSTextMessage, data)
+}
+
+// writeData writes a whole message, compressing it when negotiated and worthwhile.
+func (c *WSConn) writeData(messageType int, data []byte) error {
+	if c.compress && len(data) >= wsCompressThreshold {
+		compressed, err := deflate(data)
+		if err != nil {
+			return err
+		}
+		return c.writeFrame(true, true, messageType, compressed)
+	}
+	return c.writeFrame(true, false, messageType, data)
+}
+
+// NextWriter returns a writer for a message sent in fragments as it is written, for messages too large
+// to hold in memory. The message ends when the writer is closed; other messages wait until then.
+// Compressed messages are buffered and sent in one frame on Close.
+func (c *WSConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != WSTextMessage && messageType != WSBinaryMessage {
+		return nil, ErrWSMessageType
+	}
+	c.messageMu.Lock()
+	return &wsWriter{conn: c, opcode: messageType}, nil
+}
+
+// wsWriter writes a message in fragments.
+type wsWriter struct {
+	conn   *WSConn
+	opcode int
+	buf    []byte
+	sent   bool
+	err    error
+	closed bool
+}
+
+// Write buffers the data, sending full fragments as they fill up.
+func (w *wsWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWSClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for !w.conn.compress && len(w.buf) >= wsFragmentSize {
+		w.err = w.conn.writeFrame(false, false, w.frameOpcode(), w.buf[:wsFragmentSize])
+		if w.err != nil {
+			return 0, w.err
+		}
+		w.sent = true
+		w.buf = w.buf[wsFragmentSize:]
+	}
+	return len(p), nil
+}
+
+// Close sends the last fragment of the message.
+func (w *wsWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.conn.messageMu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if !w.sent {
+		return w.conn.writeData(w.opcode, w.buf)
+	}
+	return w.conn.writeFrame(true, false, w.frameOpcode(), w.buf)
+}
+
+// frameOpcode returns the opcode of the next fragment: the message type first, then continuation frames.
+func (w *wsWriter) frameOpcode() int {
+	if w.sent {
+		return 0
+	}
+	return w.opcode
+}
+
+// deflate compresses a message for permessage-deflate, without the final empty block.
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), wsDeflateTail[:4]), nil
+}
+
+// Ping sends a ping with the provided payload of at most 125 bytes.
+// It returns ErrWSControlTooLarge for a larger payload.
+func (c *WSConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return ErrWSControlTooLarge
+	}
+	return c.writeFrame(true, false, WSPingMessage, data)
+}
+
+// Pong sends an unsolicited pong with the provided payload of at most 125 bytes, which clients may use as
+// a heartbeat. Pings are answered automatically. It returns ErrWSControlTooLarge for a larger payload.
+func (c *WSConn) Pong(data []byte) error {
+	if len(data) > 125 {
+		return ErrWSControlTooLarge
+	}
+	return c.writeFrame(true, false, WSPongMessage, data)
+}
+
+// Close starts the closing handshake with the code and reason. Pending reads end once the client answers,
+// or after CloseTimeout; the network connection is closed when the handler returns.
+func (c *WSConn) Close(code int, reason string) error {
+	c.stateMu.Lock()
+	c.closeDeadline = time.Now().Add(c.options.CloseTimeout)
+	c.stateMu.Unlock()
+	c.conn.SetReadDeadline(c.closeDeadline)
+	return c.writeClose(closePayload(code, reason))
+}
+
+// closePayload returns the payload of a close frame, truncating the reason to fit a control frame.
+func closePayload(code int, reason string) []byte {
+	if len(reason) > 123 {
+		reason = reason[:123]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, reason...)
+}
+
+// writeClose sends a close frame unless one was already sent.
+func (c *WSConn) writeClose(payload []byte) error {
+	c.stateMu.Lock()
+	if c.closeSent {
+		c.stateMu.Unlock()
+		return nil
+	}
+	c.closeSent = true
+	c.stateMu.Unlock()
+	return c.writeFrame(true, false, WSCloseMessage, payload)
+}
+
+// writeFrame writes an unmasked frame. Data frames are refused once the closing handshake started.
+func (c *WSConn) writeFrame(fin, rsv1 bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.stateMu.Lock()
+	closing := c.closeSent && opcode != WSCloseMessage
+	c.stateMu.Unlock()
+	if closing {
+		return ErrWSClosed
+	}
+
+	header := make([]byte, 2, 10+len(payload))
+	if fin {
+		header[0] |= 0x80
+	}
+	if rsv1 {
+		header[0] |= 0x40
+	}
+	header[0] |= byte(opcode)
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if c.options.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteTimeout))
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// keepalive pings the client every PingInterval until the connection is closed.
+func (c *WSConn) keepalive() {
+	ticker := time.NewTicker(c.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Ping(nil); err != nil && !errors.Is(err, ErrWSClosed) {
+				c.shutdown(&WSCloseError{Code: WSCloseAbnormal, Reason: err.Error()})
+				return
+			}
+		}
+	}
+}
+
+// finish completes the closing handshake once the handler has returned and closes the network connection.
+func (c *WSConn) finish() {
+	if c.readError() != nil {
+		c.shutdown(nil)
+		return
+	}
+	c.Close(WSCloseNormal, "")
+
+	// Wait for the client to answer, discarding the messages still in flight
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient speaks the WebSocket protocol frame by frame, to send both valid and invalid frames.
+type wsTestClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// wsTestFrame is a frame sent or expected by a test.
+type wsTestFrame struct {
+	// first is the first byte of the frame: FIN, reserved bits and opcode.
+	first   byte
+	payload []byte
+	// unmasked sends the frame without masking it, which clients must not do.
+	unmasked bool
+}
+
+// dialWebSocket opens a WebSocket connection to the path of the test server.
+func dialWebSocket(t *testing.T, server *httptest.Server, path string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: "+server.Listener.Addr().String()+
+		"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: "+key+"\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		t.Fatalf("handshake answered %s with accept key %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return &wsTestClient{t: t, conn: conn, reader: reader}
+}
+
+// write sends the frame, masked unless the test asks otherwise.
+func (c *wsTestClient) write(frame wsTestFrame) {
+	c.t.Helper()
+	header := []byte{frame.first, 0}
+	switch length := len(frame.payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	payload := append([]byte{}, frame.payload...)
+	if !frame.unmasked {
+		header[1] |= 0x80
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		header = append(header, mask...)
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads the next frame sent by the server.
+func (c *wsTestClient) read() (wsTestFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return wsTestFrame{}, err
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Error("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(c.reader, payload)
+	return wsTestFrame{first: header[0], payload: payload}, err
+}
+
+// expectClosed checks that the server closed the connection.
+func (c *wsTestClient) expectClosed() {
+	c.t.Helper()
+	if frame, err := c.read(); err == nil {
+		c.t.Errorf("read frame %#x %q, want the connection closed", frame.first, frame.payload)
+	}
+}
+
+// Frame first bytes: FIN bit and opcode.
+const (
+	wsFin          = 0x80
+	wsFinText      = wsFin | WSTextMessage
+	wsFinBinary    = wsFin | WSBinaryMessage
+	wsFinClose     = wsFin | WSCloseMessage
+	wsFinPing      = wsFin | WSPingMessage
+	wsFinPong      = wsFin | WSPongMessage
+	wsContinuation = 0x00
+)
+
+// closeCode returns the code of a close frame, or 1005 when it has none.
+func closeCode(frame wsTestFrame) int {
+	if len(frame.payload) < 2 {
+		return WSCloseNoStatus
+	}
+	return int(binary.BigEndian.Uint16(frame.payload))
+}
+
+// newEchoServer serves a WebSocket endpoint echoing messages, reporting the error that ended the connection.
+func newEchoServer(t *testing.T, options WSOptions) (*httptest.Server, chan error) {
+	api := newTestServer(t, &OptionalParams{WebSocketOptions: options})
+	errc := make(chan error, 1)
+	api.WebSocket("/ws", func(conn *WSConn) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			conn.WriteMessage(messageType, data)
+		}
+	})
+	server := httptest.NewServer(api.ServMConfigure(nil))
+	t.Cleanup(server.Close)
+	return server, errc
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	large := []byte(strings.Repeat("x", 300))
+	tests := []struct {
+		name      string
+		readLimit int64
+		send      []wsTestFrame
+		want      []wsTestFrame
+		// wantClose is the code of the close frame failing the connection, 0 when it stays open.
+		wantClose int
+	}{
+		{
+			name: "text",
+			send: []wsTestFrame{{first: wsFinText, payload: []byte("hello")}},
+			want: []wsTestFrame{{first: wsFinText, payload: []byte("hello")}},
+		},
+		{
+			name: "binary with 16-bit length",
+			send: []wsTestFrame{{first: wsFinBinary, payload: large}},
+			want: []wsTestFrame{{first: wsFinBinary, payload: large}},
+		},
+		{
+			name: "fragmented",
+			send: []wsTestFrame{{first: WSTextMessage, payload: []byte("hel")}, {first: wsContinuation, payload: []byte("l")}, {first: wsFin, payload: []byte("o")}},
+			want: []wsTestFrame{{first: wsFinText, payload: []byte("hello")}},
+		},
+		{
+			name: "ping between fragments",
+			send: []wsTestFrame{{first: WSTextMessage, payload: []byte("a")}, {first: wsFinPing, payload: []byte("p")}, {first: wsFin, payload: []byte("b")}},
+			want: []wsTestFrame{{first: wsFinPong, payload: []byte("p")}, {first: wsFinText, payload: []byte("ab")}},
+		},
+		{
+			name: "pong ignored",
+			send: []wsTestFrame{{first: wsFinPong}, {first: wsFinText, payload: []byte("after")}},
+			want: []wsTestFrame{{first: wsFinText, payload: []byte("after")}},
+		},
+		{
+			name:      "unmasked",
+			send:      []wsTestFrame{{first: wsFinText, payload: []byte("hello"), unmasked: true}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			send:      []wsTestFrame{{first: wsFinText | 0x20, payload: []byte("hello")}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "compression not negotiated",
+			send:      []wsTestFrame{{first: wsFinText | 0x40, payload: []byte("hello")}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			send:      []wsTestFrame{{first: wsFin | 0x3}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "fragmented control frame",
+			send:      []wsTestFrame{{first: WSPingMessage}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "control frame too long",
+			send:      []wsTestFrame{{first: wsFinPing, payload: large[:126]}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "continuation without message",
+			send:      []wsTestFrame{{first: wsFin, payload: []byte("x")}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "new message inside fragmented one",
+			send:      []wsTestFrame{{first: WSTextMessage, payload: []byte("a")}, {first: wsFinText, payload: []byte("b")}},
+			wantClose: WSCloseProtocolError,
+		},
+		{
+			name:      "invalid UTF-8",
+			send:      []wsTestFrame{{first: wsFinText, payload: []byte{0xff, 0xfe}}},
+			wantClose: WSCloseInvalidPayload,
+		},
+		{
+			name:      "message too big",
+			readLimit: 16,
+			send:      []wsTestFrame{{first: WSBinaryMessage, payload: large[:10]}, {first: wsFin, payload: large[:10]}},
+			wantClose: WSCloseMessageTooBig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, errc := newEchoServer(t, WSOptions{ReadLimit: tt.readLimit})
+			client := dialWebSocket(t, server, "/ws")
+			for _, frame := range tt.send {
+				client.write(frame)
+			}
+			for _, want := range tt.want {
+				got, err := client.read()
+				if err != nil {
+					t.Fatalf("reading frame: %v", err)
+				}
+				if got.first != want.first || string(got.payload) != string(want.payload) {
+					t.Errorf("frame = %#x %q, want %#x %q", got.first, got.payload, want.first, want.payload)
+				}
+			}
+			if tt.wantClose == 0 {
+				return
+			}
+
+			got, err := client.read()
+			if err != nil {
+				t.Fatalf("reading close frame: %v", err)
+			}
+			if got.first != wsFinClose || closeCode(got) != tt.wantClose {
+				t.Errorf("frame = %#x with code %d, want close frame with code %d", got.first, closeCode(got), tt.wantClose)
+			}
+			client.expectClosed()
+			var closeErr *WSCloseError
+			if err := <-errc; !errors.As(err, &closeErr) || closeErr.Code != tt.wantClose {
+				t.Errorf("ReadMessage = %v, want close code %d", err, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestWebSocketCloseHandshake(t *testing.T) {
+	tests := []struct {
+		name string
+		// handler runs on the server; nil echoes messages.
+		handler func(conn *WSConn, errc chan error)
+		// send is sent by the client once connected, if any.
+		send *wsTestFrame
+		// wantCode is the code of the close frame the server sends.
+		wantCode int
+		// answer makes the client answer the close frame of the server.
+		answer bool
+		// wantErr is the close code returned to the handler by ReadMessage.
+		wantErr    int
+		wantReason string
+	}{
+		{
+			name:       "client closes",
+			send:       &wsTestFrame{first: wsFinClose, payload: closePayload(WSCloseGoingAway, "bye")},
+			wantCode:   WSCloseGoingAway,
+			wantErr:    WSCloseGoingAway,
+			wantReason: "bye",
+		},
+		{
+			name:     "client closes without code",
+			send:     &wsTestFrame{first: wsFinClose},
+			wantCode: WSCloseNoStatus,
+			wantErr:  WSCloseNoStatus,
+		},
+		{
+			name:       "client closes with reserved code",
+			send:       &wsTestFrame{first: wsFinClose, payload: closePayload(WSCloseAbnormal, "")},
+			wantCode:   WSCloseProtocolError,
+			wantErr:    WSCloseProtocolError,
+			wantReason: "invalid close code",
+		},
+		{
+			name:       "client closes with one byte payload",
+			send:       &wsTestFrame{first: wsFinClose, payload: []byte{0x03}},
+			wantCode:   WSCloseProtocolError,
+			wantErr:    WSCloseProtocolError,
+			wantReason: "invalid close frame",
+		},
+		{
+			name: "server closes",
+			handler: func(conn *WSConn, errc chan error) {
+				conn.Close(4000, "done")
+				_, _, err := conn.ReadMessage()
+				errc <- err
+			},
+			wantCode: 4000,
+			answer:   true,
+			// The client answers with the code only
+			wantErr: 4000,
+		},
+		{
+			name: "client does not answer",
+			handler: func(conn *WSConn, errc chan error) {
+				conn.Close(WSCloseNormal, "")
+				_, _, err := conn.ReadMessage()
+				errc <- err
+			},
+			wantCode:   WSCloseNormal,
+			wantErr:    WSCloseAbnormal,
+			wantReason: "closing handshake timed out",
+		},
+		{
+			name: "handler returns",
+			handler: func(conn *WSConn, errc chan error) {
+				errc <- nil
+			},
+			wantCode: WSCloseNormal,
+			answer:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := WSOptions{CloseTimeout: 200 * time.Millisecond}
+			var (
+				server *httptest.Server
+				errc   chan error
+			)
+			if tt.handler == nil {
+				server, errc = newEchoServer(t, options)
+			} else {
+				api := newTestServer(t, &OptionalParams{WebSocketOptions: options})
+				errc = make(chan error, 1)
+				api.WebSocket("/ws", func(conn *WSConn) { tt.handler(conn, errc) })
+				server = httptest.NewServer(api.ServMConfigure(nil))
+				defer server.Close()
+			}
+			client := dialWebSocket(t, server, "/ws")
+			if tt.send != nil {
+				client.write(*tt.send)
+			}
+
+			got, err := client.read()
+			if err != nil {
+				t.Fatalf("reading close frame: %v", err)
+			}
+			if got.first != wsFinClose || closeCode(got) != tt.wantCode {
+				t.Errorf("frame = %#x with code %d, want close frame with code %d", got.first, closeCode(got), tt.wantCode)
+			}
+			if tt.answer {
+				client.write(wsTestFrame{first: wsFinClose, payload: got.payload[:2]})
+			}
+			client.expectClosed()
+
+			err = <-errc
+			if tt.wantErr == 0 {
+				if err != nil {
+					t.Errorf("handler error = %v, want nil", err)
+				}
+				return
+			}
+			var closeErr *WSCloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tt.wantErr || closeErr.Reason != tt.wantReason {
+				t.Errorf("ReadMessage = %v, want close code %d with reason %q", err, tt.wantErr, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestWebSocketCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		host    string
+		origin  string
+		want    bool
+	}{
+		{name: "no origin", host: "api.example.com", want: true},
+		{name: "same origin", host: "api.example.com:8443", origin: "https://api.example.com:8443", want: true},
+		{name: "other origin", host: "api.example.com", origin: "https://evil.com", want: false},
+		{name: "invalid origin", host: "api.example.com", origin: "null", want: false},
+		{name: "any", allowed: []string{"*"}, host: "api.example.com", origin: "https://evil.com", want: true},
+		{name: "full origin", allowed: []string{"https://app.example.com"}, host: "api.example.com", origin: "https://app.example.com", want: true},
+		{name: "full origin other scheme", allowed: []string{"https://app.example.com"}, host: "api.example.com", origin: "http://app.example.com", want: false},
+		{name: "host", allowed: []string{"app.example.com"}, host: "api.example.com", origin: "https://APP.example.com", want: true},
+		{name: "host any port", allowed: []string{"app.example.com"}, host: "api.example.com", origin: "http://app.example.com:3000", want: true},
+		{name: "host with port", allowed: []string{"app.example.com:3000"}, host: "api.example.com", origin: "http://app.example.com:3000", want: true},
+		{name: "host with other port", allowed: []string{"app.example.com:3000"}, host: "api.example.com", origin: "http://app.example.com:4000", want: false},
+		{name: "wildcard", allowed: []string{"*.example.com"}, host: "api.example.com", origin: "https://app.example.com", want: true},
+		{name: "wildcard with port", allowed: []string{"*.example.com"}, host: "api.example.com", origin: "https://app.example.com:8443", want: true},
+		{name: "wildcard bare domain", allowed: []string{"*.example.com"}, host: "api.example.com", origin: "https://example.com", want: false},
+		{name: "wildcard suffix only", allowed: []string{"*.example.com"}, host: "api.example.com", origin: "https://evilexample.com", want: false},
+		{name: "wildcard other domain with port", allowed: []string{"*.example.com"}, host: "api.example.com", origin: "https://example.com.evil.com:443", want: false},
+		{name: "IPv6 host", allowed: []string{"[::1]"}, host: "api.example.com", origin: "http://[::1]:3000", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := (WSOptions{AllowedOrigins: tt.allowed}).checkOrigin(r); got != tt.want {
+				t.Errorf("checkOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketControlFrames(t *testing.T) {
+	payload := []byte(strings.Repeat("p", 126))
+	tests := []struct {
+		name      string
+		send      func(conn *WSConn, data []byte) error
+		first     byte
+		size      int
+		wantErr   error
+		wantFrame bool
+	}{
+		{name: "ping", send: (*WSConn).Ping, first: wsFinPing, size: 125, wantFrame: true},
+		{name: "empty ping", send: (*WSConn).Ping, first: wsFinPing, size: 0, wantFrame: true},
+		{name: "pong", send: (*WSConn).Pong, first: wsFinPong, size: 125, wantFrame: true},
+		{name: "oversized ping", send: (*WSConn).Ping, size: 126, wantErr: ErrWSControlTooLarge},
+		{name: "oversized pong", send: (*WSConn).Pong, size: 126, wantErr: ErrWSControlTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestServer(t, nil)
+			errc := make(chan error, 1)
+			api.WebSocket("/ws", func(conn *WSConn) {
+				errc <- tt.send(conn, payload[:tt.size])
+				conn.WriteMessage(WSTextMessage, []byte("end"))
+			})
+			server := httptest.NewServer(api.ServMConfigure(nil))
+			defer server.Close()
+
+			client := dialWebSocket(t, server, "/ws")
+			if err := <-errc; !errors.Is(err, tt.wantErr) {
+				t.Fatalf("send = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantFrame {
+				frame, err := client.read()
+				if err != nil || frame.first != tt.first || len(frame.payload) != tt.size {
+					t.Fatalf("frame = %#x with %d bytes, %v, want %#x with %d bytes", frame.first, len(frame.payload), err, tt.first, tt.size)
+				}
+			}
+			// Nothing was sent for an oversized payload
+			if frame, err := client.read(); err != nil || frame.first != wsFinText || string(frame.payload) != "end" {
+				t.Errorf("next frame = %#x %q, %v, want the text message", frame.first, frame.payload, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+   Package server provides functionality for creating and managing HTTP servers, including middleware support.
+
+   Author: Sabyasachi Roy
+*/
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WSHub tracks open WebSocket connections and their rooms, for broadcasting messages to many clients.
+// The connections of the server WebSocket endpoints are registered with the server hub, returned by
+// MyAPIServer.WSHub, for as long as their handler runs. Its methods are safe for concurrent use.
+type WSHub struct {
+	mu     sync.RWMutex
+	conns  map[*WSConn]map[string]bool
+	rooms  map[string]map[*WSConn]bool
+	closed bool
+}
+
+// NewWSHub creates an empty WSHub.
+func NewWSHub() *WSHub {
+	return &WSHub{
+		conns: make(map[*WSConn]map[string]bool),
+		rooms: make(map[string]map[*WSConn]bool),
+	}
+}
+
+// WSHub returns the hub of the server, creating it on first use. Its connections are closed when the server shuts down.
+func (api *MyAPIServer) WSHub() *WSHub {
+	api.wsOnce.Do(func() {
+		api.wsHub = NewWSHub()
+	})
+	return api.wsHub
+}
+
+// Register adds the connection to the hub. Connections registered after the hub was closed are closed right away.
+func (h *WSHub) Register(conn *WSConn) {
+	h.mu.Lock()
+	closed := h.closed
+	if _, ok := h.conns[conn]; !ok && !closed {
+		h.conns[conn] = make(map[string]bool)
+	}
+	h.mu.Unlock()
+	if closed {
+		conn.Close(WSCloseGoingAway, "server shutting down")
+	}
+}
+
+// Unregister removes the connection from the hub and from all its rooms.
+func (h *WSHub) Unregister(conn *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for room := range h.conns[conn] {
+		h.leaveLocked(conn, room)
+	}
+	delete(h.conns, conn)
+}
+
+// Join adds the connection to the room, registering it with the hub if needed.
+func (h *WSHub) Join(conn *WSConn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if _, ok := h.conns[conn]; !ok {
+		h.conns[conn] = make(map[string]bool)
+	}
+	h.conns[conn][room] = true
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*WSConn]bool)
+	}
+	h.rooms[room][conn] = true
+}
+
+// Leave removes the connection from the room.
+func (h *WSHub) Leave(conn *WSConn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(conn, room)
+}
+
+// leaveLocked removes the connection from the room while h.mu is held, dropping empty rooms.
+func (h *WSHub) leaveLocked(conn *WSConn, room string) {
+	delete(h.conns[conn], room)
+	delete(h.rooms[room], conn)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Rooms returns the rooms the connection has joined.
+func (h *WSHub) Rooms(conn *WSConn) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]string, 0, len(h.conns[conn]))
+	for room := range h.conns[conn] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Members returns the connections in the room.
+func (h *WSHub) Members(room string) []*WSConn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	members := make([]*WSConn, 0, len(h.rooms[room]))
+	for conn := range h.rooms[room] {
+		members = append(members, conn)
+	}
+	return members
+}
+
+// Len returns the number of connections registered with the hub.
+func (h *WSHub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Broadcast sends the message to every connection of the hub except the excluded ones.
+func (h *WSHub) Broadcast(messageType int, data []byte, except ...*WSConn) {
+	h.mu.RLock()
+	conns := make([]*WSConn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+	broadcast(conns, messageType, data, except)
+}
+
+// BroadcastRoom sends the message to every connection in the room except the excluded ones.
+func (h *WSHub) BroadcastRoom(room string, messageType int, data []byte, except ...*WSConn) {
+	broadcast(h.Members(room), messageType, data, except)
+}
+
+// broadcast writes the message to the connections concurrently, so that a slow client only delays itself.
+// Connections failing the write are closed.
+func broadcast(conns []*WSConn, messageType int, data []byte, except []*WSConn) {
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		if containsConn(except, conn) {
+			continue
+		}
+		wg.Add(1)
+		go func(conn *WSConn) {
+			defer wg.Done()
+			if err := conn.WriteMessage(messageType, data); err != nil && err != ErrWSClosed {
+				conn.shutdown(&WSCloseError{Code: WSCloseAbnormal, Reason: err.Error()})
+			}
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// containsConn reports whether the connection is in the list.
+func containsConn(conns []*WSConn, conn *WSConn) bool {
+	for _, c := range conns {
+		if c == conn {
+			return true
+		}
+	}
+	return false
+}
+
+// CloseAll starts the closing handshake of every connection of the hub with the code and reason.
+func (h *WSHub) CloseAll(code int, reason string) {
+	h.mu.RLock()
+	conns := make([]*WSConn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+	for _, conn := range conns {
+		conn.Close(code, reason)
+	}
+}
+
+// Shutdown closes the hub: new connections are refused, open ones are sent a 1001 Going Away close frame,
+// then Shutdown waits for their handlers to return. Connections still open when the context ends are
+// closed without completing the handshake, and the context error is returned.
+func (h *WSHub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.CloseAll(WSCloseGoingAway, "server shutting down")
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for h.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			h.mu.RLock()
+			for conn := range h.conns {
+				conn.shutdown(&WSCloseError{Code: WSCloseAbnormal, Reason: "server shut down"})
+			}
+			h.mu.RUnlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// isClosed reports whether the hub has been shut down.
+func (h *WSHub) isClosed() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.closed
+}